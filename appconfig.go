@@ -1,74 +1,235 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/wiggin77/cfg"
+	"github.com/wiggin77/cfg/timeconv"
 )
 
 type configKey struct {
 	name string
 	def  string
 	req  bool
-	inc  incRule
+	typ  keyType
+	// secret keys may instead be supplied by a variant key such as
+	// token_file, token_command or token_vault_url
+	secret bool
+	// global keys apply to the whole config and are not allowed in host sections
+	global bool
 }
 
-type incRule int
+type keyType int
 
 const (
-	// ALWAYS means the key is always added to API query string
-	ALWAYS incRule = iota
-	// NEVER means the key is never added to API query string
-	NEVER
-	// NOTEMPTY means the key is added to API query string only when a non-empty string
-	NOTEMPTY
-	// NOTFALSE means the key is added to API query string only when not "NO" or "OFF"
-	NOTFALSE
+	// TYPESTRING means any value is accepted
+	TYPESTRING keyType = iota
+	// TYPEHOST means a DNS hostname or domain
+	TYPEHOST
+	// TYPEIP means an IPv4 or IPv6 address
+	TYPEIP
+	// TYPEBOOL means one of "YES", "NO", "ON", "OFF", "TRUE", "FALSE"
+	TYPEBOOL
+	// TYPEDURATION means a number plus unit of measure such as "11 minutes"
+	TYPEDURATION
+	// TYPEPROTO means "http" or "https"
+	TYPEPROTO
+	// TYPEDETECT means one of the IP detection methods
+	TYPEDETECT
+	// TYPEURL means an absolute http or https URL
+	TYPEURL
+	// TYPEHOSTPATH means a hostname plus path, without scheme
+	TYPEHOSTPATH
+	// TYPEMAINT means maintenance windows; see parseMaintenance
+	TYPEMAINT
+	// TYPEMAINTMODE means "suspend" or "offline"
+	TYPEMAINTMODE
+	// TYPETIMEZONE means an IANA time zone name such as "Europe/London"
+	TYPETIMEZONE
+	// TYPEINT means a whole number greater than zero
+	TYPEINT
+	// TYPEHEALTHCHECK means a failover health check; see probe
+	TYPEHEALTHCHECK
+	// TYPETLSVERSION means a TLS version such as "1.2"
+	TYPETLSVERSION
+	// TYPEPIN means comma separated SPKI pins; see parsePins
+	TYPEPIN
+	// TYPESIZE means a number of bytes with an optional unit such as "10 MB"
+	TYPESIZE
+	// TYPELOGFORMAT means "text", "json" or "logfmt"
+	TYPELOGFORMAT
+	// TYPESYSLOGADDR means a remote syslog server such as "udp://logs.example.com:514"
+	TYPESYSLOGADDR
+	// TYPEFACILITY means a syslog facility name such as "daemon" or "local0"
+	TYPEFACILITY
+	// TYPESYSLOGFORMAT means "rfc3164" or "rfc5424"
+	TYPESYSLOGFORMAT
 )
 
 // Configuration keys
 var (
-	keyProtocolVersion = configKey{name: "protocol_ver", def: "1.3", req: false, inc: NEVER}
-	keyURL             = configKey{name: "url", def: "api.cp.easydns.com/dyn/generic.php", req: false, inc: NEVER}
-	keyUsername        = configKey{name: "username", def: "", req: true, inc: NEVER}
-	keyToken           = configKey{name: "token", def: "", req: true, inc: NEVER}
-	keyHostname        = configKey{name: "hostname", def: "", req: true, inc: ALWAYS}
-	keyTld             = configKey{name: "tld", def: "", req: false, inc: NOTEMPTY}
-	keyMyIP            = configKey{name: "myip", def: "1.1.1.1", req: false, inc: ALWAYS}
-	keyMx              = configKey{name: "mx", def: "", req: false, inc: NOTEMPTY}
-	keyBackMx          = configKey{name: "backmx", def: "NO", req: false, inc: NOTFALSE}
-	keyWildcard        = configKey{name: "wildcard", def: "OFF", req: false, inc: NOTFALSE}
-	keyInterval        = configKey{name: "interval", def: "11 minutes", req: false, inc: NEVER}
-	keyLogFile         = configKey{name: "log", def: "", req: false, inc: NEVER}
-	keySyslog          = configKey{name: "syslog", def: "NO", req: false, inc: NEVER}
-	keyVerbose         = configKey{name: "verbose", def: "NO", req: false, inc: NEVER}
-	keyProto           = configKey{name: "proto", def: "https", req: false, inc: NEVER}
-
-	keysAll = []configKey{keyProtocolVersion, keyURL, keyUsername, keyToken, keyHostname, keyTld,
-		keyMyIP, keyMx, keyBackMx, keyWildcard, keyInterval}
+	keyProtocolVersion = configKey{name: "protocol_ver", def: "1.3", req: false, typ: TYPESTRING}
+	keyURL             = configKey{name: "url", def: "api.cp.easydns.com/dyn/generic.php", req: false, typ: TYPEHOSTPATH}
+	keyUsername        = configKey{name: "username", def: "", req: true, typ: TYPESTRING}
+	keyToken           = configKey{name: "token", def: "", req: true, typ: TYPESTRING, secret: true}
+	keyTokenFile       = configKey{name: "token_file", def: "", req: false, typ: TYPESTRING}
+	keyTokenCommand    = configKey{name: "token_command", def: "", req: false, typ: TYPESTRING}
+	keyTokenVaultURL   = configKey{name: "token_vault_url", def: "", req: false, typ: TYPEURL}
+	keySecretTTL       = configKey{name: "secret_ttl", def: "1 hour", req: false, typ: TYPEDURATION, global: true}
+	keyInclude         = configKey{name: "include", def: "", req: false, typ: TYPESTRING, global: true}
+	keyHostname        = configKey{name: "hostname", def: "", req: true, typ: TYPEHOST}
+	keyTld             = configKey{name: "tld", def: "", req: false, typ: TYPEHOST}
+	keyMyIP            = configKey{name: "myip", def: "1.1.1.1", req: false, typ: TYPEIP}
+	keyMx              = configKey{name: "mx", def: "", req: false, typ: TYPEHOST}
+	keyBackMx          = configKey{name: "backmx", def: "NO", req: false, typ: TYPEBOOL}
+	keyWildcard        = configKey{name: "wildcard", def: "OFF", req: false, typ: TYPEBOOL}
+	keyInterval        = configKey{name: "interval", def: "11 minutes", req: false, typ: TYPEDURATION, global: true}
+	keyLogFile         = configKey{name: "log", def: "", req: false, typ: TYPESTRING, global: true}
+	keyLogFormat       = configKey{name: "log_format", def: "text", req: false, typ: TYPELOGFORMAT, global: true}
+	keyLogMaxSize      = configKey{name: "log_max_size", def: "", req: false, typ: TYPESIZE, global: true}
+	keyLogMaxAge       = configKey{name: "log_max_age", def: "", req: false, typ: TYPEDURATION, global: true}
+	keyLogMaxBackups   = configKey{name: "log_max_backups", def: "5", req: false, typ: TYPEINT, global: true}
+	keyLogMaxBackupAge = configKey{name: "log_max_backup_age", def: "", req: false, typ: TYPEDURATION, global: true}
+	keyLogCompress     = configKey{name: "log_compress", def: "YES", req: false, typ: TYPEBOOL, global: true}
+	keySyslog          = configKey{name: "syslog", def: "NO", req: false, typ: TYPEBOOL, global: true}
+	keySyslogAddress   = configKey{name: "syslog_address", def: "", req: false, typ: TYPESYSLOGADDR, global: true}
+	keySyslogFacility  = configKey{name: "syslog_facility", def: "daemon", req: false, typ: TYPEFACILITY, global: true}
+	keySyslogTag       = configKey{name: "syslog_tag", def: "dynip", req: false, typ: TYPESTRING, global: true}
+	keySyslogFormat    = configKey{name: "syslog_format", def: "rfc3164", req: false, typ: TYPESYSLOGFORMAT, global: true}
+	keySyslogCAFile    = configKey{name: "syslog_ca_file", def: "", req: false, typ: TYPESTRING, global: true}
+	keyVerbose         = configKey{name: "verbose", def: "NO", req: false, typ: TYPEBOOL, global: true}
+	keyProto           = configKey{name: "proto", def: "https", req: false, typ: TYPEPROTO}
+	keyDetect          = configKey{name: "detect", def: "server", req: false, typ: TYPEDETECT}
+	keyDetectURL       = configKey{name: "detect_url", def: "", req: false, typ: TYPEURL}
+	keyOfflineOnStop   = configKey{name: "offline_on_stop", def: "NO", req: false, typ: TYPEBOOL, global: true}
+	keyDetectInterface = configKey{name: "detect_interface", def: "", req: false, typ: TYPESTRING}
+	keySkipUnchanged   = configKey{name: "skip_unchanged", def: "NO", req: false, typ: TYPEBOOL}
+	keyPublicOnly      = configKey{name: "public_only", def: "NO", req: false, typ: TYPEBOOL}
+	keyMaintenance     = configKey{name: "maintenance", def: "", req: false, typ: TYPEMAINT}
+	keyMaintDuration   = configKey{name: "maintenance_duration", def: "", req: false, typ: TYPEDURATION}
+	keyMaintMode       = configKey{name: "maintenance_mode", def: "suspend", req: false, typ: TYPEMAINTMODE}
+	keyMaintTimezone   = configKey{name: "maintenance_timezone", def: "", req: false, typ: TYPETIMEZONE}
+	keyNotifyCommand   = configKey{name: "notify_command", def: "", req: false, typ: TYPESTRING}
+	keyDetectTimeout   = configKey{name: "detect_timeout", def: "30 seconds", req: false, typ: TYPEDURATION}
+	keyUpdateTimeout   = configKey{name: "update_timeout", def: "90 seconds", req: false, typ: TYPEDURATION}
+	keySecretTimeout   = configKey{name: "secret_timeout", def: "30 seconds", req: false, typ: TYPEDURATION}
+	keyNotifyTimeout   = configKey{name: "notify_timeout", def: "30 seconds", req: false, typ: TYPEDURATION}
+	keyStopTimeout     = configKey{name: "stop_timeout", def: "10 seconds", req: false, typ: TYPEDURATION, global: true}
+	keyBindInterface   = configKey{name: "bind_interface", def: "", req: false, typ: TYPESTRING}
+	keyBindAddress     = configKey{name: "bind_address", def: "", req: false, typ: TYPEIP}
+	keyProxy           = configKey{name: "proxy", def: "", req: false, typ: TYPESTRING}
+	keyTLSCAFile       = configKey{name: "tls_ca_file", def: "", req: false, typ: TYPESTRING}
+	keyTLSCADir        = configKey{name: "tls_ca_dir", def: "", req: false, typ: TYPESTRING}
+	keyTLSMinVersion   = configKey{name: "tls_min_version", def: "", req: false, typ: TYPETLSVERSION}
+	keyTLSPin          = configKey{name: "tls_pin", def: "", req: false, typ: TYPEPIN}
+	keyTLSCertFile     = configKey{name: "tls_cert_file", def: "", req: false, typ: TYPESTRING}
+	keyTLSKeyFile      = configKey{name: "tls_key_file", def: "", req: false, typ: TYPESTRING}
+	keyTLSInsecure     = configKey{name: "tls_insecure_skip_verify", def: "NO", req: false, typ: TYPEBOOL}
+	keyFailover        = configKey{name: "failover", def: "", req: false, typ: TYPESTRING}
+	keyFailoverCheck   = configKey{name: "failover_check", def: "", req: false, typ: TYPEHEALTHCHECK}
+	keyFailoverRise    = configKey{name: "failover_rise", def: "3", req: false, typ: TYPEINT}
+	keyFailoverFall    = configKey{name: "failover_fall", def: "2", req: false, typ: TYPEINT}
+	keyFailoverTimeout = configKey{name: "failover_timeout", def: "5 seconds", req: false, typ: TYPEDURATION}
+	keyFailoverPeriod  = configKey{name: "failover_interval", def: "30 seconds", req: false, typ: TYPEDURATION, global: true}
+	keyHistory         = configKey{name: "history", def: "", req: false, typ: TYPESTRING, global: true}
+	keyHistoryMaxSize  = configKey{name: "history_max_size", def: "10 MB", req: false, typ: TYPESIZE, global: true}
+	keyHistoryMaxAge   = configKey{name: "history_max_age", def: "1 year", req: false, typ: TYPEDURATION, global: true}
+
+	keysAll = []configKey{keyProtocolVersion, keyURL, keyUsername, keyToken, keyTokenFile,
+		keyTokenCommand, keyTokenVaultURL, keySecretTTL, keyHostname, keyTld,
+		keyMyIP, keyMx, keyBackMx, keyWildcard, keyInterval, keyLogFile, keySyslog, keyVerbose, keyProto,
+		keyLogFormat, keyLogMaxSize, keyLogMaxAge, keyLogMaxBackups, keyLogMaxBackupAge, keyLogCompress,
+		keySyslogAddress, keySyslogFacility, keySyslogTag, keySyslogFormat, keySyslogCAFile,
+		keyDetect, keyDetectURL, keyDetectInterface, keySkipUnchanged, keyPublicOnly, keyInclude, keyOfflineOnStop,
+		keyMaintenance, keyMaintDuration, keyMaintMode, keyMaintTimezone, keyNotifyCommand,
+		keyFailover, keyFailoverCheck, keyFailoverRise, keyFailoverFall, keyFailoverTimeout, keyFailoverPeriod,
+		keyBindInterface, keyBindAddress, keyProxy,
+		keyTLSCAFile, keyTLSCADir, keyTLSMinVersion, keyTLSPin, keyTLSCertFile, keyTLSKeyFile, keyTLSInsecure,
+		keyDetectTimeout, keyUpdateTimeout, keySecretTimeout, keyNotifyTimeout, keyStopTimeout,
+		keyHistory, keyHistoryMaxSize, keyHistoryMaxAge}
+
+	// secretVariants maps each secret key name to the keys that may supply
+	// its value instead, in the order they are checked within a source.
+	secretVariants = map[string][]configKey{keyToken.name: {keyTokenFile, keyTokenCommand, keyTokenVaultURL}}
 )
 
 // AppConfig provides convenience methods for fetching ShadowCrypt
 // specific properties.
+//
+// A config may contain host sections, such as [office] in a conf file.
+// Each section is a host which inherits the top level keys.
 type AppConfig struct {
-	cfg.Config
-	verified bool // ensures factory method must be used
+	*cfg.Config
+	verified bool         // ensures factory method must be used
+	srcs     []cfg.Source // same order as the embedded Config, for secrets
+	section  string       // host section name; empty for the top level
+	secrets  *secretCache // shared by the top level and all hosts
+	offline  string       // file listing hosts set offline; see offline.go
+	history  string       // default history journal; see history.go
+
+	// selectedIP is the address chosen by failover health checks in the
+	// daemon; it takes the place of detection
+	selectedIP string
+}
+
+// secretCache holds the resolvers for secret keys, created on first use
+// so cached secrets persist between updates.
+type secretCache struct {
+	mutex     sync.Mutex
+	resolvers map[string]secretResolver // keyed by variant name and value
+}
+
+func newAppConfig() *AppConfig {
+	return &AppConfig{
+		Config:   &cfg.Config{},
+		verified: false,
+		secrets:  &secretCache{resolvers: make(map[string]secretResolver)},
+	}
 }
 
 // NewAppConfig creates an instance of AppConfig and verifies the
-// contents of the specified config file.
+// contents of the specified config file. The file format is chosen by
+// extension. DYNIP_* environment variables take precedence over the
+// config file.
 func NewAppConfig(file string) (*AppConfig, error) {
-	config := &AppConfig{verified: false}
+	return NewAppConfigFormat(file, formatAuto)
+}
+
+// NewAppConfigFormat creates an instance of AppConfig from a config file
+// in the specified format: conf, yaml, toml, json or auto. Files matched
+// by the include key take precedence over the config file.
+func NewAppConfigFormat(file string, format string) (*AppConfig, error) {
+	config := newAppConfig()
+	config.offline = offlineFile(file)
+	config.history = historyFile(file)
 
 	// create file Source using file spec and append
 	// to Config
-	src, err := cfg.NewSrcFileFromFilespec(file)
+	src, err := newFileSource(file, format)
 	if err != nil {
 		return config, err
 	}
 	config.AppendSource(src)
 
+	// included files
+	props, err := src.GetProps()
+	if err != nil {
+		return config, err
+	}
+	if patterns := includePatterns(file, props[keyInclude.name]); len(patterns) > 0 {
+		inc, err := newSrcInclude(patterns)
+		if err != nil {
+			return config, err
+		}
+		config.PrependSource(inc)
+	}
+	config.PrependSource(newSrcEnv())
+
 	// Verify all the required properties exist.
 	err = config.verify()
 	if err == nil {
@@ -80,7 +241,7 @@ func NewAppConfig(file string) (*AppConfig, error) {
 // NewAppConfigFromMap creates an instance of AppConfig containing
 // a copy of the specified map elements.
 func NewAppConfigFromMap(m map[string]string) (*AppConfig, error) {
-	config := &AppConfig{verified: false}
+	config := newAppConfig()
 	src := cfg.NewSrcMapFromMap(m)
 	config.AppendSource(src)
 	err := config.verify()
@@ -90,21 +251,218 @@ func NewAppConfigFromMap(m map[string]string) (*AppConfig, error) {
 	return config, err
 }
 
-// getKeyVal returns the value of the specified key.
+// PrependSource inserts one or more Sources ahead of existing sources.
+func (config *AppConfig) PrependSource(srcs ...cfg.Source) {
+	config.srcs = append(append([]cfg.Source{}, srcs...), config.srcs...)
+	config.Config.PrependSource(srcs...)
+}
+
+// AppendSource appends one or more Sources after existing sources.
+func (config *AppConfig) AppendSource(srcs ...cfg.Source) {
+	config.srcs = append(config.srcs, srcs...)
+	config.Config.AppendSource(srcs...)
+}
+
+// String returns the value of the named property. For a host, a value in
+// the host's section takes precedence over the top level.
+func (config *AppConfig) String(name string, def string) (string, error) {
+	if config.section != "" {
+		if val, err := config.Config.String(config.section+"."+name, ""); err == nil {
+			return val, nil
+		}
+	}
+	return config.Config.String(name, def)
+}
+
+// Duration returns the value of the named property as a time.Duration.
+// See String.
+func (config *AppConfig) Duration(name string, def time.Duration) (time.Duration, error) {
+	s, err := config.String(name, "")
+	if err != nil {
+		return def, err
+	}
+	ms, err := timeconv.ParseMilliseconds(s)
+	if err != nil {
+		return def, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// timeout returns the value of a duration key such as update_timeout, or
+// the key's default if the value is missing or invalid.
+func (config *AppConfig) timeout(key configKey) time.Duration {
+	ms, _ := timeconv.ParseMilliseconds(key.def)
+	def := time.Duration(ms) * time.Millisecond
+	d, err := config.Duration(key.name, def)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// hosts returns a config for each host section, sorted by name. If there
+// are no host sections the top level config is the only host.
+func (config *AppConfig) hosts() []*AppConfig {
+	names := config.hostNames()
+	if len(names) == 0 {
+		return []*AppConfig{config}
+	}
+	arr := make([]*AppConfig, 0, len(names))
+	for _, name := range names {
+		arr = append(arr, config.host(name))
+	}
+	return arr
+}
+
+// host returns the config for the named host section.
+func (config *AppConfig) host(name string) *AppConfig {
+	return &AppConfig{
+		Config:   config.Config,
+		verified: config.verified,
+		srcs:     config.srcs,
+		section:  name,
+		secrets:  config.secrets,
+		offline:  config.offline,
+		history:  config.history,
+	}
+}
+
+// hostName returns the name of the host section, or empty string for
+// the top level.
+func (config *AppConfig) hostName() string {
+	return config.section
+}
+
+// hostNames returns the sorted names of all host sections. A section is
+// any prefix of a known key, e.g. "office" for "office.hostname".
+func (config *AppConfig) hostNames() []string {
+	set := make(map[string]bool)
+	for _, src := range config.srcs {
+		props, err := src.GetProps()
+		if err != nil {
+			continue
+		}
+		for k := range props {
+			if section, key := splitKey(k); section != "" && isKnownKey(key) {
+				set[section] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitKey splits a key name into host section and key, e.g.
+// "office.hostname" into "office" and "hostname".
+func splitKey(name string) (section string, key string) {
+	if i := strings.Index(name, "."); i != -1 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// isKnownKey returns true if name is one of keysAll.
+func isKnownKey(name string) bool {
+	for _, k := range keysAll {
+		if k.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getKeyVal returns the value of the specified key. Secret keys that
+// cannot be resolved return an empty string.
 func (config *AppConfig) getKeyVal(key configKey) string {
+	if key.secret {
+		val, _ := config.getSecret(key)
+		return val
+	}
 	val, _ := config.String(key.name, key.def)
 	return val
 }
 
+// getSecret returns the value of a secret key. Sources are checked in
+// order for either the key or one of its variants (see secretVariants),
+// and the first one found wins.
+func (config *AppConfig) getSecret(key configKey) (string, error) {
+	return config.getSecretContext(context.Background(), key)
+}
+
+// getSecretContext is getSecret with a context; a lookup that runs a
+// command or fetches from a secret store is abandoned when ctx is done or
+// after secret_timeout.
+func (config *AppConfig) getSecretContext(ctx context.Context, key configKey) (string, error) {
+	res, val := config.findSecret(key)
+	if res != nil {
+		ctx, cancel := context.WithTimeout(ctx, config.timeout(keySecretTimeout))
+		defer cancel()
+		return res.Resolve(ctx)
+	}
+	return val, nil
+}
+
+// findSecret returns the resolver for the first variant of a secret key
+// found, or the literal value if the key itself is found first. For a
+// host, the host section is searched before the top level.
+func (config *AppConfig) findSecret(key configKey) (secretResolver, string) {
+	prefixes := []string{""}
+	if config.section != "" {
+		prefixes = []string{config.section + ".", ""}
+	}
+	for _, prefix := range prefixes {
+		for _, src := range config.srcs {
+			props, err := src.GetProps()
+			if err != nil {
+				continue
+			}
+			if val := strings.TrimSpace(props[prefix+key.name]); val != "" {
+				return nil, val
+			}
+			for _, variant := range secretVariants[key.name] {
+				if val := strings.TrimSpace(props[prefix+variant.name]); val != "" {
+					return config.getResolver(variant, val), ""
+				}
+			}
+		}
+	}
+	return nil, key.def
+}
+
+// getResolver returns the resolver for a variant key and value, creating
+// it on first use so cached secrets persist between updates.
+func (config *AppConfig) getResolver(variant configKey, val string) secretResolver {
+	config.secrets.mutex.Lock()
+	defer config.secrets.mutex.Unlock()
+
+	id := variant.name + "=" + val
+	res, ok := config.secrets.resolvers[id]
+	if !ok {
+		ttl, _ := config.Duration(keySecretTTL.name, time.Hour)
+		res = newSecretResolver(variant, val, ttl)
+		config.secrets.resolvers[id] = res
+	}
+	return res
+}
+
+// invalidateSecret discards any cached value of a secret key so it is
+// fetched again when next used.
+func (config *AppConfig) invalidateSecret(key configKey) {
+	if res, _ := config.findSecret(key); res != nil {
+		res.Invalidate()
+	}
+}
+
 // Verify all the required properties exist
 func (config *AppConfig) verify() error {
-	// Check all required keys are present with non-empty values
-	for _, k := range keysAll {
-		if k.req {
-			val, err := config.String(k.name, "")
-			if err != nil || val == "" {
-				return fmt.Errorf("key %s missing", k.name)
-			}
+	// Check all required keys are present with non-empty values for every host
+	for _, host := range config.hosts() {
+		if err := host.verifyHost(); err != nil {
+			return err
 		}
 	}
 
@@ -117,6 +475,33 @@ func (config *AppConfig) verify() error {
 	return nil
 }
 
+// verifyHost checks all required keys are present with non-empty values.
+func (config *AppConfig) verifyHost() error {
+	for _, k := range keysAll {
+		if !k.req {
+			continue
+		}
+		name := k.name
+		if config.section != "" {
+			name = config.section + "." + k.name
+		}
+		var val string
+		var err error
+		if k.secret {
+			val, err = config.getSecret(k)
+		} else {
+			val, err = config.String(k.name, "")
+		}
+		if err != nil {
+			return fmt.Errorf("key %s: %v", name, err)
+		}
+		if val == "" {
+			return fmt.Errorf("key %s missing", name)
+		}
+	}
+	return nil
+}
+
 // getKeys returns a slice containing all config keys.
 func (config *AppConfig) getKeys() []configKey {
 	return keysAll
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newHTTPClient creates an HTTP client for detection and update requests.
+// Connections are made from the host's bind_address, or the address of
+// bind_interface, so multi-homed hosts use the intended link, and through
+// the host's proxy if any.
+func newHTTPClient(appConfig *AppConfig, timeout time.Duration) (*http.Client, error) {
+	dialer, err := newDialer(appConfig, timeout)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := proxyFunc(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialContext(dialer),
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// newDialer creates a dialer bound to the host's bind_address and/or
+// bind_interface.
+func newDialer(appConfig *AppConfig, timeout time.Duration) (*net.Dialer, error) {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+
+	addr := appConfig.getKeyVal(keyBindAddress)
+	iface := appConfig.getKeyVal(keyBindInterface)
+	if addr == "" && iface != "" {
+		var err error
+		if addr, err = detectFromInterface(iface); err != nil {
+			return nil, fmt.Errorf("%s: %v", keyBindInterface.name, err)
+		}
+	}
+	if addr != "" {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("%s: '%s' is not an IP address", keyBindAddress.name, addr)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	if iface != "" {
+		dialer.Control = bindToDevice(iface)
+	}
+	return dialer, nil
+}
+
+// dialContext returns a dial function that uses the address family of the
+// dialer's local address, so a server with both IPv4 and IPv6 addresses is
+// reached over the family that can be bound.
+func dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if local, ok := dialer.LocalAddr.(*net.TCPAddr); ok && network == "tcp" {
+			if local.IP.To4() != nil {
+				network = "tcp4"
+			} else {
+				network = "tcp6"
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"syscall"
+)
+
+// bindToDevice returns a dialer Control function that binds sockets to the
+// named interface with SO_BINDTODEVICE, so traffic leaves through it
+// regardless of the routing table. This needs CAP_NET_RAW on older kernels.
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"syscall"
+)
+
+// bindToDevice returns nil on platforms without SO_BINDTODEVICE; sockets
+// are bound to the interface's address instead.
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
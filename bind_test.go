@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_newDialer(t *testing.T) {
+	cfg, err := NewAppConfigFromMap(map[string]string{"hostname": "office.example.com", "username": "u", "token": "t", "bind_address": "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer, err := newDialer(cfg, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local, ok := dialer.LocalAddr.(*net.TCPAddr); !ok || !local.IP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("LocalAddr = %v, want 127.0.0.1", dialer.LocalAddr)
+	}
+
+	cfg, err = NewAppConfigFromMap(map[string]string{"hostname": "office.example.com", "username": "u", "token": "t", "bind_interface": "nosuchif0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newDialer(cfg, time.Second); err == nil {
+		t.Error("newDialer() with a missing interface should fail")
+	}
+}
+
+func Test_newHTTPClient(t *testing.T) {
+	var remote string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote = r.RemoteAddr
+		_, _ = fmt.Fprintln(w, "203.0.113.9")
+	}))
+	defer ts.Close()
+
+	cfg, err := NewAppConfigFromMap(map[string]string{"hostname": "office.example.com", "username": "u", "token": "t", "bind_address": "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, err := detectFromURL(context.Background(), cfg, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "203.0.113.9" {
+		t.Errorf("detectFromURL() = %s, want 203.0.113.9", ip)
+	}
+	if host, _, _ := net.SplitHostPort(remote); host != "127.0.0.1" {
+		t.Errorf("request came from %s, want 127.0.0.1", remote)
+	}
+}
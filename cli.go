@@ -0,0 +1,399 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wiggin77/cfg"
+)
+
+// cliOpts holds the options shared by every command: the config file, its
+// format and verbose logging, plus the service options. Each command
+// loads the config through loadConfig so they all resolve it the same way.
+type cliOpts struct {
+	file    string
+	format  string
+	verbose bool
+	srv     srvOpt
+}
+
+func newCLIOpts() *cliOpts {
+	return &cliOpts{
+		file:   defConfigFile(),
+		format: formatAuto,
+		srv:    srvOpt{name: defaultServiceName, description: defaultServiceDescription},
+	}
+}
+
+// addConfigFlags adds the config file flags. The defaults are the current
+// values, so flags given before a command carry over to it.
+func (o *cliOpts) addConfigFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.file, "f", o.file, "config file")
+	fs.StringVar(&o.format, "format", o.format, "config file format: auto, conf, yaml, toml or json")
+	fs.BoolVar(&o.verbose, "v", o.verbose, "overrides verbose setting in config")
+}
+
+// loadConfig loads the config file. If -v was given it overrides the
+// verbose setting in the config.
+func (o *cliOpts) loadConfig() (*AppConfig, error) {
+	appConfig, err := NewAppConfigFormat(o.file, o.format)
+	if err != nil {
+		return appConfig, err
+	}
+	if o.verbose {
+		src := cfg.NewSrcMapFromMap(map[string]string{"verbose": "YES"})
+		appConfig.PrependSource(src)
+	}
+	return appConfig, nil
+}
+
+// service returns the service options for the config file.
+func (o *cliOpts) service() *srvOpt {
+	o.srv.config = o.file
+	o.srv.format = o.format
+	return &o.srv
+}
+
+// command is a dynip command such as `update` or `service install`. A
+// command either has subcommands or a bind function.
+type command struct {
+	name    string
+	args    string // positional arguments, for the usage line
+	summary string
+	config  bool     // takes the config file flags
+	words   []string // completions for the positional arguments
+	// bind adds the command's own flags and returns the function that
+	// runs it with the arguments left after the flags.
+	bind func(fs *flag.FlagSet, o *cliOpts) func(args []string, result *appResult)
+	subs []*command
+}
+
+// commandAliases are the commands of earlier versions.
+var commandAliases = map[string][]string{
+	"start":   {"service", "start"},
+	"stop":    {"service", "stop"},
+	"restart": {"service", "restart"},
+	"status":  {"service", "status"},
+}
+
+// commandTable returns the commands in the order they are listed in help.
+func commandTable() []*command {
+	cmds := []*command{
+		{name: "update", summary: "Update the IP address of each host once (the default)", config: true,
+			bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+				output := fs.String("o", outputText, "output format: text or json")
+				dryrun := fs.Bool("n", false, "dry run; show the update that would be sent without sending it")
+				return func(args []string, result *appResult) { cmdUpdate(o, *output, *dryrun, result) }
+			}},
+		{name: "daemon", summary: "Update at each interval until stopped, as the service does", config: true,
+			bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+				fs.StringVar(&o.srv.name, "name", o.srv.name, "service name, when run by the service manager")
+				fs.Var(&o.srv.env, "env", "KEY=VALUE environment variable to set; may be repeated")
+				return func(args []string, result *appResult) { cmdDaemon(o, result) }
+			}},
+		{name: "service", summary: "Install, uninstall and control the service", subs: []*command{
+			{name: "install", summary: "Install the service for the config file", config: true,
+				bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+					addServiceFlags(fs, &o.srv)
+					return func(args []string, result *appResult) { cmdServiceInstall(o, result) }
+				}},
+			{name: "uninstall", summary: "Uninstall the service", bind: bindServiceName(func(o *cliOpts, result *appResult) {
+				cmdServiceUninstall(o, result)
+			})},
+			{name: "start", summary: "Start the installed service", bind: bindServiceAction("start")},
+			{name: "stop", summary: "Stop the service", bind: bindServiceAction("stop")},
+			{name: "restart", summary: "Restart the service", bind: bindServiceAction("restart")},
+			{name: "status", summary: "Show whether the service is running", bind: bindServiceAction("status")},
+		}},
+		{name: "config", summary: "Check or show the config", subs: []*command{
+			{name: "check", summary: "Strictly validate the config file", config: true,
+				bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+					return func(args []string, result *appResult) { cmdConfigCheck(o, result) }
+				}},
+			{name: "dump", summary: "Show the effective config, with secrets redacted", config: true,
+				bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+					output := fs.String("o", outputText, "output format: text or json")
+					return func(args []string, result *appResult) { cmdConfigDump(o, *output, result) }
+				}},
+			{name: "schema", summary: "Write the JSON schema for config files",
+				bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+					return func(args []string, result *appResult) { cmdConfigSchema(result) }
+				}},
+		}},
+		{name: "offline", args: "[host]", summary: "Set hosts offline and stop updating them", config: true,
+			bind: bindOffline(false)},
+		{name: "online", args: "[host]", summary: "Bring hosts back online and update them", config: true,
+			bind: bindOffline(true)},
+		{name: "history", summary: "List the update history", config: true,
+			bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+				ho := &historyOpt{}
+				addHistoryFlags(fs, ho)
+				return func(args []string, result *appResult) { cmdHistory(o, ho, result) }
+			}},
+		{name: "init", summary: "Write a config file from a few questions",
+			bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+				fs.StringVar(&o.file, "f", o.file, "config file to write")
+				force := fs.Bool("force", false, "overwrite an existing config file")
+				return func(args []string, result *appResult) { cmdInit(o.file, *force, result) }
+			}},
+		{name: "fake-server", summary: "Run a fake provider for testing",
+			bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+				fo := &fakeServerOpt{}
+				addFakeServerFlags(fs, fo)
+				return func(args []string, result *appResult) { cmdFakeServer(fo, result) }
+			}},
+		{name: "completion", args: "bash|zsh|fish", summary: "Write a shell completion script",
+			words: []string{"bash", "zsh", "fish"},
+			bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+				return func(args []string, result *appResult) { cmdCompletion(args, result) }
+			}},
+		{name: "version", summary: "Show the version",
+			bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+				return func(args []string, result *appResult) { result.exitMsg = appVersion }
+			}},
+		{name: "help", args: "[command [subcommand]]", summary: "Show help for a command",
+			bind: func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+				return func(args []string, result *appResult) { cmdHelp(args, o, result) }
+			}},
+	}
+	for _, cmd := range cmds {
+		if cmd.name == "help" {
+			for _, c := range cmds {
+				cmd.words = append(cmd.words, c.name)
+			}
+		}
+	}
+	return cmds
+}
+
+// bindServiceName binds a service command taking only -name.
+func bindServiceName(run func(o *cliOpts, result *appResult)) func(*flag.FlagSet, *cliOpts) func([]string, *appResult) {
+	return func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+		fs.StringVar(&o.srv.name, "name", o.srv.name, "service name")
+		return func(args []string, result *appResult) { run(o, result) }
+	}
+}
+
+func bindServiceAction(action string) func(*flag.FlagSet, *cliOpts) func([]string, *appResult) {
+	return bindServiceName(func(o *cliOpts, result *appResult) { cmdService(action, o, result) })
+}
+
+func bindOffline(online bool) func(*flag.FlagSet, *cliOpts) func([]string, *appResult) {
+	return func(fs *flag.FlagSet, o *cliOpts) func([]string, *appResult) {
+		return func(args []string, result *appResult) {
+			var host string
+			if len(args) > 0 {
+				host = args[0]
+			}
+			cmdOffline(o, host, online, result)
+		}
+	}
+}
+
+// findCommand returns the command named by the leading arguments, its
+// path such as "service install", and the arguments after its name.
+// A command with subcommands is returned when none is named.
+func findCommand(cmds []*command, args []string) (*command, string, []string, error) {
+	var cmd *command
+	var path []string
+	for len(args) > 0 && (cmd == nil || cmd.subs != nil) && !strings.HasPrefix(args[0], "-") {
+		var next *command
+		for _, c := range cmds {
+			if c.name == args[0] {
+				next = c
+			}
+		}
+		if next == nil {
+			return nil, "", nil, fmt.Errorf("unknown command '%s'", strings.Join(append(path, args[0]), " "))
+		}
+		cmd, cmds, args = next, next.subs, args[1:]
+		path = append(path, cmd.name)
+	}
+	return cmd, strings.Join(path, " "), args, nil
+}
+
+// commandFlags returns the flag set for a command along with the function
+// that runs it.
+func commandFlags(cmd *command, path string, o *cliOpts) (*flag.FlagSet, func([]string, *appResult)) {
+	fs := flag.NewFlagSet("dynip "+path, flag.ContinueOnError)
+	if cmd.config {
+		o.addConfigFlags(fs)
+	}
+	return fs, cmd.bind(fs, o)
+}
+
+// runCLI runs the command line. Without a command the flags of earlier
+// versions are accepted and mapped onto commands.
+func runCLI(args []string, result *appResult) {
+	o := newCLIOpts()
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runLegacy(o, args, result)
+		return
+	}
+	runArgs(o, args, result)
+}
+
+// runArgs runs the command named by args, such as
+// ["service", "install", "-name", "dynip-office"].
+func runArgs(o *cliOpts, args []string, result *appResult) {
+	if alias, ok := commandAliases[args[0]]; ok {
+		args = append(append([]string{}, alias...), args[1:]...)
+	}
+	cmds := commandTable()
+	cmd, path, args, err := findCommand(cmds, args)
+	if err != nil {
+		result.exitCode = exitUsage
+		result.exitMsg = fmt.Sprintf("%v; run 'dynip help' for the commands", err)
+		return
+	}
+	if cmd.subs != nil {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			writeHelp(os.Stderr, cmd, path, o)
+			return
+		}
+		result.exitCode = exitUsage
+		result.exitMsg = fmt.Sprintf("dynip %s needs a command; run 'dynip help %s'", path, path)
+		return
+	}
+
+	fs, run := commandFlags(cmd, path, o)
+	fs.Usage = func() { writeHelp(fs.Output(), cmd, path, o) }
+	if err := fs.Parse(args); err != nil {
+		if err != flag.ErrHelp {
+			result.exitCode = exitUsage
+		}
+		return
+	}
+	if fs.NArg() > maxArgs(cmd) {
+		result.exitCode = exitUsage
+		result.exitMsg = fmt.Sprintf("unexpected argument '%s'; usage: %s", fs.Arg(maxArgs(cmd)), usageLine(cmd, path, fs))
+		return
+	}
+	run(fs.Args(), result)
+}
+
+// maxArgs returns the number of positional arguments a command takes.
+func maxArgs(cmd *command) int {
+	if cmd.args == "" {
+		return 0
+	}
+	return len(strings.Fields(cmd.args))
+}
+
+// runLegacy runs a command line of flags only, as used before there were
+// commands, e.g. `dynip -i -f /etc/dynip.conf`. A command may also follow
+// the flags, e.g. `dynip -f dynip.conf config check`.
+func runLegacy(o *cliOpts, args []string, result *appResult) {
+	var daemon, install, uninstall, version, help, dryrun bool
+	var output string
+	fs := flag.NewFlagSet("dynip", flag.ContinueOnError)
+	o.addConfigFlags(fs)
+	addServiceFlags(fs, &o.srv)
+	fs.BoolVar(&daemon, "d", false, "run as a daemon; same as `dynip daemon`")
+	fs.BoolVar(&install, "i", false, "install as service/daemon; same as `dynip service install`")
+	fs.BoolVar(&uninstall, "u", false, "uninstall service/daemon; same as `dynip service uninstall`")
+	fs.BoolVar(&version, "version", false, "display version info")
+	fs.BoolVar(&help, "h", false, "display help")
+	fs.StringVar(&output, "o", outputText, "output format for one-shot update: text or json")
+	fs.BoolVar(&dryrun, "n", false, "dry run; show the update that would be sent without sending it")
+	fs.Usage = func() { writeHelp(fs.Output(), nil, "", o) }
+	if err := fs.Parse(args); err != nil {
+		if err != flag.ErrHelp {
+			result.exitCode = exitUsage
+		}
+		return
+	}
+
+	cmd := []string{"update", "-o", output, "-n=" + strconv.FormatBool(dryrun)}
+	switch {
+	case help:
+		cmd = []string{"help"}
+	case version:
+		cmd = []string{"version"}
+	case fs.NArg() > 0:
+		cmd = fs.Args()
+	case install:
+		cmd = []string{"service", "install"}
+	case uninstall:
+		cmd = []string{"service", "uninstall"}
+	case daemon:
+		cmd = []string{"daemon"}
+	}
+	runArgs(o, cmd, result)
+}
+
+// cmdHelp runs `dynip help [command]`.
+func cmdHelp(args []string, o *cliOpts, result *appResult) {
+	cmd, path, rest, err := findCommand(commandTable(), args)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("unknown command '%s'", strings.Join(args, " "))
+	}
+	if err != nil {
+		result.exitCode = exitUsage
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	writeHelp(os.Stdout, cmd, path, o)
+}
+
+// usageLine returns the usage line for a command.
+func usageLine(cmd *command, path string, fs *flag.FlagSet) string {
+	line := "dynip " + path
+	if cmd.subs != nil {
+		return line + " <command>"
+	}
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		line += " [flags]"
+	}
+	if cmd.args != "" {
+		line += " " + cmd.args
+	}
+	return line
+}
+
+// writeHelp writes the help for a command: its usage and flags, or its
+// subcommands. A nil command writes the help for dynip itself.
+func writeHelp(w io.Writer, cmd *command, path string, o *cliOpts) {
+	if cmd == nil {
+		fmt.Fprintf(w, "Usage: dynip [command] [flags]\n\nCommands:\n")
+		writeCommandList(w, commandTable())
+		fmt.Fprintf(w, "\nWithout a command dynip runs update. Run 'dynip help <command>' for the flags\n")
+		fmt.Fprintf(w, "of a command. The flags of earlier versions, such as -d, -i, -u and -version,\n")
+		fmt.Fprintf(w, "still work.\n")
+		return
+	}
+	if cmd.subs != nil {
+		fmt.Fprintf(w, "Usage: dynip %s <command>\n\n%s.\n\nCommands:\n", path, cmd.summary)
+		writeCommandList(w, cmd.subs)
+		return
+	}
+	// a copy, so showing the defaults does not change the options
+	oc := *o
+	fs, _ := commandFlags(cmd, path, &oc)
+	fmt.Fprintf(w, "Usage: %s\n\n%s.\n", usageLine(cmd, path, fs), cmd.summary)
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintf(w, "\nFlags:\n")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+}
+
+func writeCommandList(w io.Writer, cmds []*command) {
+	width := 0
+	for _, c := range cmds {
+		if len(c.name) > width {
+			width = len(c.name)
+		}
+	}
+	for _, c := range cmds {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, c.name, c.summary)
+	}
+}
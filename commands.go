@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/kardianos/service"
+)
+
+// cmdUpdate runs `dynip update`, which updates each host once or, with
+// dryrun, shows the update that would be sent.
+func cmdUpdate(o *cliOpts, output string, dryrun bool, result *appResult) {
+	if err := checkOutputFormat(output); err != nil {
+		result.exitCode = exitUsage
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+
+	if dryrun {
+		reports := dryRun(o)
+		var err error
+		if output == outputJSON {
+			err = reports.writeJSON(os.Stdout)
+		} else {
+			err = reports.writeText(os.Stdout)
+		}
+		result.exitCode = reports.exitCode()
+		if err != nil {
+			result.exitCode = -1
+			result.exitMsg = fmt.Sprintf("%v", err)
+		}
+		return
+	}
+
+	reports := runOnce(o, output)
+	result.exitCode = reports.exitCode()
+	if output == outputJSON {
+		if err := reports.writeJSON(os.Stdout); err != nil {
+			result.exitCode = -1
+			result.exitMsg = fmt.Sprintf("%v", err)
+		}
+		return
+	}
+	result.exitMsg = reports.text()
+}
+
+// cmdDaemon runs `dynip daemon`, the update loop run by the service.
+func cmdDaemon(o *cliOpts, result *appResult) {
+	// environment variables from -env, as given on the service command line
+	if err := setServiceEnv(o.srv.env); err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	if err := serviceRun(o); err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+	}
+}
+
+// cmdServiceInstall runs `dynip service install`.
+func cmdServiceInstall(o *cliOpts, result *appResult) {
+	if err := serviceInstall(o.service()); err != nil {
+		result.exitCode = -5
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	result.exitMsg = "install successful"
+}
+
+// cmdServiceUninstall runs `dynip service uninstall`.
+func cmdServiceUninstall(o *cliOpts, result *appResult) {
+	if err := serviceUninstall(o.service()); err != nil {
+		result.exitCode = -6
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	result.exitMsg = "uninstall successful"
+}
+
+// cmdService runs `dynip service start`, `stop`, `restart` or `status` for
+// the service named by -name.
+func cmdService(action string, o *cliOpts, result *appResult) {
+	srv := o.service()
+	if action != "status" {
+		if err := serviceControl(srv, action); err != nil {
+			result.exitCode = -1
+			result.exitMsg = fmt.Sprintf("%s %s: %v", action, srv.name, err)
+			return
+		}
+		result.exitMsg = fmt.Sprintf("%s %s successful", action, srv.name)
+		return
+	}
+
+	// exit codes follow the LSB init script status convention
+	status, err := serviceStatus(srv)
+	switch {
+	case err == service.ErrNotInstalled:
+		result.exitCode = 4
+		result.exitMsg = fmt.Sprintf("%s: not installed", srv.name)
+	case err != nil:
+		result.exitCode = 4
+		result.exitMsg = fmt.Sprintf("%s: unknown: %v", srv.name, err)
+	case status == service.StatusRunning:
+		result.exitMsg = fmt.Sprintf("%s: running", srv.name)
+	case status == service.StatusStopped:
+		result.exitCode = 3
+		result.exitMsg = fmt.Sprintf("%s: stopped", srv.name)
+	default:
+		result.exitCode = 4
+		result.exitMsg = fmt.Sprintf("%s: unknown", srv.name)
+	}
+}
+
+// cmdConfigCheck runs `dynip config check`, which strictly validates the
+// config file.
+func cmdConfigCheck(o *cliOpts, result *appResult) {
+	probs, err := checkConfigFile(o.file, o.format)
+	if err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	var errs, warns int
+	for _, p := range probs {
+		fmt.Fprintln(os.Stdout, p)
+		if p.sev == WARNING {
+			warns++
+		} else {
+			errs++
+		}
+	}
+	if errs > 0 {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%s: %d error(s), %d warning(s)", o.file, errs, warns)
+		return
+	}
+	result.exitMsg = fmt.Sprintf("%s: OK, %d warning(s)", o.file, warns)
+}
+
+// cmdConfigDump runs `dynip config dump`, which shows the effective config
+// after environment variables, included files and defaults are applied.
+func cmdConfigDump(o *cliOpts, output string, result *appResult) {
+	if output != outputText && output != outputJSON {
+		result.exitCode = exitUsage
+		result.exitMsg = fmt.Sprintf("output format must be %s or %s", outputText, outputJSON)
+		return
+	}
+	appConfig, err := o.loadConfig()
+	if err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	if err := writeConfigDump(os.Stdout, appConfig, output); err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+	}
+}
+
+// cmdConfigSchema runs `dynip config schema`.
+func cmdConfigSchema(result *appResult) {
+	if err := writeSchema(os.Stdout); err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+	}
+}
+
+// configDump returns the effective value of every key that has one: the
+// top level keys, then host section keys that differ from the top level,
+// as "office.hostname". Secrets are redacted and are not resolved, so no
+// secret command is run or secret store contacted.
+func configDump(appConfig *AppConfig) map[string]string {
+	value := func(config *AppConfig, key configKey) string {
+		val, _ := config.String(key.name, key.def)
+		switch {
+		case val == "":
+		case key.secret:
+			val = redacted
+		case key.name == keyProxy.name:
+			val = redactProxy(val)
+		}
+		return val
+	}
+	m := make(map[string]string)
+	for _, key := range keysAll {
+		if val := value(appConfig, key); val != "" {
+			m[key.name] = val
+		}
+	}
+	for _, name := range appConfig.hostNames() {
+		host := appConfig.host(name)
+		for _, key := range keysAll {
+			if key.global {
+				continue
+			}
+			if val := value(host, key); val != m[key.name] {
+				m[name+"."+key.name] = val
+			}
+		}
+	}
+	return m
+}
+
+// writeConfigDump writes configDump as conf file lines or a JSON object.
+func writeConfigDump(w io.Writer, appConfig *AppConfig, output string) error {
+	m := configDump(appConfig)
+	if output == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	// top level keys first, in the order of keysAll
+	order := make(map[string]int)
+	for i, key := range keysAll {
+		order[key.name] = i
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		si, ki := splitKey(names[i])
+		sj, kj := splitKey(names[j])
+		if si != sj {
+			return si < sj
+		}
+		return order[ki] < order[kj]
+	})
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%s = %s\n", name, m[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// cmdCompletion runs `dynip completion bash|zsh|fish`, which writes a
+// completion script for the shell.
+func cmdCompletion(args []string, result *appResult) {
+	if len(args) != 1 || (args[0] != "bash" && args[0] != "zsh" && args[0] != "fish") {
+		result.exitCode = exitUsage
+		result.exitMsg = "usage: dynip completion bash|zsh|fish"
+		return
+	}
+	if err := writeCompletion(os.Stdout, args[0]); err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+	}
+}
+
+// completionEntry is a command path, such as "service install", with the
+// words that may follow it: subcommands, or flags and argument values.
+type completionEntry struct {
+	path      string
+	words     []string
+	summaries []string // for subcommands; empty for flags and values
+	flags     []*flag.Flag
+}
+
+// completionEntries walks the command table. The top level is the entry
+// with an empty path.
+func completionEntries() []*completionEntry {
+	var entries []*completionEntry
+	var walk func(path string, cmds []*command)
+	walk = func(path string, cmds []*command) {
+		entry := &completionEntry{path: path}
+		entries = append(entries, entry)
+		for _, cmd := range cmds {
+			entry.words = append(entry.words, cmd.name)
+			entry.summaries = append(entry.summaries, cmd.summary)
+		}
+		for _, cmd := range cmds {
+			sub := strings.TrimSpace(path + " " + cmd.name)
+			if cmd.subs != nil {
+				walk(sub, cmd.subs)
+				continue
+			}
+			fs, _ := commandFlags(cmd, sub, &cliOpts{})
+			leaf := &completionEntry{path: sub, words: cmd.words}
+			fs.VisitAll(func(f *flag.Flag) { leaf.flags = append(leaf.flags, f) })
+			entries = append(entries, leaf)
+		}
+	}
+	walk("", commandTable())
+	return entries
+}
+
+// isBoolFlag returns true if the flag takes no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// writeCompletion writes the completion script for a shell. The zsh
+// script uses the bash one through bashcompinit.
+func writeCompletion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		return writeBashCompletion(w)
+	case "zsh":
+		if _, err := fmt.Fprint(w, "#compdef dynip\nautoload -U +X bashcompinit && bashcompinit\n\n"); err != nil {
+			return err
+		}
+		return writeBashCompletion(w)
+	case "fish":
+		return writeFishCompletion(w)
+	}
+	return fmt.Errorf("no completion for shell '%s'; use bash, zsh or fish", shell)
+}
+
+func writeBashCompletion(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString(`# dynip completion; generated by dynip completion bash
+_dynip()
+{
+    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+    local path="" words="" i
+    COMPREPLY=()
+    # the command is the words before the first flag
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case ${COMP_WORDS[i]} in
+        -*) break ;;
+        *) path="${path:+$path }${COMP_WORDS[i]}" ;;
+        esac
+    done
+    case $path in
+`)
+	valueFlags := map[string]bool{}
+	for _, entry := range completionEntries() {
+		words := entry.words
+		for _, f := range entry.flags {
+			words = append(words, "-"+f.Name)
+			if !isBoolFlag(f) {
+				valueFlags["-"+f.Name] = true
+			}
+		}
+		fmt.Fprintf(&sb, "    %q) words=%q ;;\n", entry.path, strings.Join(words, " "))
+	}
+	sb.WriteString("    esac\n")
+	if len(valueFlags) > 0 {
+		// a flag value: leave it to the default, file name completion
+		names := make([]string, 0, len(valueFlags))
+		for name := range valueFlags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&sb, "    case $prev in\n    %s) return ;;\n    esac\n", strings.Join(names, "|"))
+	}
+	sb.WriteString(`    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+complete -o default -F _dynip dynip
+`)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeFishCompletion(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString(`# dynip completion; generated by dynip completion fish
+function __dynip_path
+    set -l path
+    for word in (commandline -opc)[2..-1]
+        string match -q -- '-*' $word; and break
+        set -a path $word
+    end
+    test "$path" = "$argv[1]"
+end
+complete -c dynip -f
+`)
+	for _, entry := range completionEntries() {
+		cond := fishQuote("__dynip_path " + fishQuote(entry.path))
+		for i, word := range entry.words {
+			fmt.Fprintf(&sb, "complete -c dynip -n %s -a %s", cond, fishQuote(word))
+			if i < len(entry.summaries) {
+				fmt.Fprintf(&sb, " -d %s", fishQuote(entry.summaries[i]))
+			}
+			sb.WriteString("\n")
+		}
+		for _, f := range entry.flags {
+			fmt.Fprintf(&sb, "complete -c dynip -n %s -o %s", cond, f.Name)
+			if !isBoolFlag(f) {
+				sb.WriteString(" -rF")
+			}
+			fmt.Fprintf(&sb, " -d %s\n", fishQuote(f.Usage))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// fishQuote quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func Test_writeCompletion(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{shell: "bash", want: []string{
+			`"") words="update daemon service config`,
+			`"service install") words="-arg -depends -description -dir -env -f -format -name -pw -user -v" ;;`,
+			`"completion") words="bash zsh fish" ;;`,
+			"complete -o default -F _dynip dynip\n",
+		}},
+		{shell: "zsh", want: []string{"#compdef dynip\n", "bashcompinit", "complete -o default -F _dynip dynip\n"}},
+		{shell: "fish", want: []string{
+			`complete -c dynip -n '__dynip_path \'\'' -a 'service' -d 'Install, uninstall and control the service'`,
+			`complete -c dynip -n '__dynip_path \'service install\'' -o user -rF -d 'user account name to run service'`,
+			`complete -c dynip -n '__dynip_path \'update\'' -o n -d 'dry run;`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeCompletion(&buf, tt.shell); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("%s completion missing %q", tt.shell, want)
+				}
+			}
+		})
+	}
+	if err := writeCompletion(&bytes.Buffer{}, "tcsh"); err == nil {
+		t.Error("writeCompletion(tcsh) accepted")
+	}
+}
+
+func Test_bashCompletion(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("no bash")
+	}
+	var buf bytes.Buffer
+	if err := writeCompletion(&buf, "bash"); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String() + `
+complete_words() { COMP_WORDS=("$@"); COMP_CWORD=$(($# - 1)); _dynip; echo "${COMPREPLY[*]}"; }
+complete_words dynip serv
+complete_words dynip service st
+complete_words dynip history -s
+complete_words dynip update -f ""
+`
+	out, err := exec.Command(bash, "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	want := "service\nstart stop status\n-since\n\n"
+	if string(out) != want {
+		t.Errorf("completions = %q, want %q", out, want)
+	}
+}
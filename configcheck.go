@@ -0,0 +1,709 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wiggin77/cfg/timeconv"
+)
+
+// configEntry is a single key/value pair and where it was defined.
+type configEntry struct {
+	file string
+	line int
+	key  string
+	val  string
+}
+
+type severity int
+
+const (
+	// ERROR means the config will not work as intended
+	ERROR severity = iota
+	// WARNING means the config works but is likely wrong
+	WARNING
+)
+
+// configProblem is one issue found by checkConfig.
+type configProblem struct {
+	file string
+	line int // zero if the problem is not tied to a line
+	key  string
+	msg  string
+	sev  severity
+}
+
+func (p configProblem) String() string {
+	var sb strings.Builder
+	if p.file != "" {
+		sb.WriteString(p.file)
+		if p.line > 0 {
+			fmt.Fprintf(&sb, ":%d", p.line)
+		}
+		sb.WriteString(": ")
+	}
+	if p.sev == WARNING {
+		sb.WriteString("warning: ")
+	} else {
+		sb.WriteString("error: ")
+	}
+	if p.key != "" {
+		sb.WriteString(p.key)
+		sb.WriteString(": ")
+	}
+	sb.WriteString(p.msg)
+	return sb.String()
+}
+
+// configProblems is the list of problems found in a config.
+type configProblems []configProblem
+
+// hasErrors returns true if any problem is an error rather than a warning.
+func (probs configProblems) hasErrors() bool {
+	for _, p := range probs {
+		if p.sev == ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfigFile reads the config file and any included files and strictly
+// validates their contents. An error is returned only if the config file
+// cannot be read or parsed; problems with included files are reported as
+// config problems naming the file.
+func checkConfigFile(file string, format string) (configProblems, error) {
+	entries, err := readFileEntries(file, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var probs configProblems
+	var include string
+	for _, e := range entries {
+		if e.key == keyInclude.name {
+			include = e.val
+		}
+	}
+	files, err := includeFiles(includePatterns(file, include))
+	if err != nil {
+		probs = append(probs, configProblem{file: file, key: keyInclude.name, msg: err.Error()})
+	}
+	for _, inc := range files {
+		incEntries, err := readFileEntries(inc, formatAuto)
+		if err != nil {
+			probs = append(probs, configProblem{file: inc, msg: err.Error()})
+			continue
+		}
+		for _, e := range incEntries {
+			if e.key == keyInclude.name {
+				probs = append(probs, configProblem{file: e.file, line: e.line, key: e.key,
+					msg: "included files cannot include other files"})
+			}
+		}
+		entries = append(entries, incEntries...)
+	}
+
+	entries = append(entries, envEntries(os.LookupEnv)...)
+	return append(probs, checkConfig(entries)...), nil
+}
+
+// readFileEntries returns the entries of a config file in any format.
+func readFileEntries(file string, format string) ([]configEntry, error) {
+	format, err := configFormat(file, format)
+	if err != nil {
+		return nil, err
+	}
+	if format != formatConf {
+		return readStructEntries(file, format)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return readConfigEntries(f, file)
+}
+
+// envEntries returns an entry for each DYNIP_* environment variable that
+// sets a known key. The variable name is used in place of a file name.
+func envEntries(lookup func(string) (string, bool)) []configEntry {
+	var entries []configEntry
+	for _, k := range keysAll {
+		name := envName(k.name)
+		if val, ok := lookup(name); ok {
+			entries = append(entries, configEntry{file: "$" + name, key: k.name, val: strings.TrimSpace(val)})
+		}
+	}
+	return entries
+}
+
+// readConfigEntries reads name/value pairs, recording the line number of each.
+// Keys within a [section] are prefixed with the section name and a dot, the
+// same as the key names seen by AppConfig.
+func readConfigEntries(r io.Reader, file string) ([]configEntry, error) {
+	var entries []configEntry
+	var section string
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") || strings.HasPrefix(s, ";") {
+			continue
+		}
+		if strings.HasPrefix(s, "[") {
+			if i := strings.Index(s, "]"); i != -1 {
+				section = strings.TrimSpace(s[1:i])
+				continue
+			}
+		}
+		entry := configEntry{file: file, line: line}
+		i := strings.Index(s, "=")
+		if i == -1 {
+			entry.val = s
+		} else {
+			entry.key = strings.TrimSpace(s[:i])
+			entry.val = strings.TrimSpace(s[i+1:])
+		}
+		if section != "" && entry.key != "" {
+			entry.key = section + "." + entry.key
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// checkConfig validates config entries: unknown keys, the format of each
+// value, and problems involving more than one key. Keys in a host section
+// are named "section.key"; each host is checked with the top level keys
+// it inherits.
+func checkConfig(entries []configEntry) configProblems {
+	var probs configProblems
+	known := make(map[string]configKey)
+	for _, k := range keysAll {
+		known[k.name] = k
+	}
+
+	// effective value of each key; the last definition wins
+	vals := make(map[string]configEntry)
+	for _, e := range entries {
+		if e.key == "" {
+			probs = append(probs, configProblem{file: e.file, line: e.line,
+				msg: fmt.Sprintf("not a key/value pair: '%s'", e.val)})
+			continue
+		}
+		section, name := splitKey(e.key)
+		k, ok := known[name]
+		if !ok {
+			msg := "unknown key"
+			if s := suggestKey(name); s != "" {
+				if section != "" {
+					s = section + "." + s
+				}
+				msg = fmt.Sprintf("unknown key (did you mean \"%s\"?)", s)
+			}
+			probs = append(probs, configProblem{file: e.file, line: e.line, key: e.key, msg: msg})
+			continue
+		}
+		if section != "" && k.global {
+			probs = append(probs, configProblem{file: e.file, line: e.line, key: e.key,
+				msg: "only allowed at the top level, not in a host section"})
+			continue
+		}
+		if prev, ok := vals[e.key]; ok && prev.file == e.file {
+			probs = append(probs, configProblem{file: e.file, line: e.line, key: e.key, sev: WARNING,
+				msg: fmt.Sprintf("overrides value defined on line %d", prev.line)})
+		}
+		vals[e.key] = e
+		if e.val == "" {
+			continue
+		}
+		if err := checkValue(k.typ, e.val); err != nil {
+			probs = append(probs, configProblem{file: e.file, line: e.line, key: e.key, msg: err.Error()})
+		}
+	}
+
+	var file string
+	if len(entries) > 0 {
+		file = entries[0].file
+	}
+	sections := make(map[string]bool)
+	for key := range vals {
+		if section, _ := splitKey(key); section != "" {
+			sections[section] = true
+		}
+	}
+	if len(sections) == 0 {
+		probs = append(probs, checkCrossField(file, "", hostView(vals, ""))...)
+	} else {
+		names := make([]string, 0, len(sections))
+		for section := range sections {
+			names = append(names, section)
+		}
+		sort.Strings(names)
+		for _, section := range names {
+			probs = append(probs, checkCrossField(file, section, hostView(vals, section))...)
+		}
+	}
+	return append(probs, checkGlobal(file, hostView(vals, ""))...)
+}
+
+// hostView returns the entries seen by a host section, keyed by key name
+// without the section prefix. Host section values override the top level;
+// a secret supplied in the section replaces all variants of that secret
+// at the top level.
+func hostView(vals map[string]configEntry, section string) map[string]configEntry {
+	view := make(map[string]configEntry)
+	for key, e := range vals {
+		if !strings.Contains(key, ".") {
+			view[key] = e
+		}
+	}
+	if section == "" {
+		return view
+	}
+	prefix := section + "."
+	for secret, variants := range secretVariants {
+		group := append([]configKey{{name: secret}}, variants...)
+		for _, k := range group {
+			if _, ok := vals[prefix+k.name]; ok {
+				for _, other := range group {
+					delete(view, other.name)
+				}
+				break
+			}
+		}
+	}
+	for key, e := range vals {
+		if strings.HasPrefix(key, prefix) {
+			view[strings.TrimPrefix(key, prefix)] = e
+		}
+	}
+	return view
+}
+
+// checkCrossField checks a host for missing required keys and inconsistent
+// combinations of keys. Global keys are checked by checkGlobal.
+func checkCrossField(file string, section string, vals map[string]configEntry) configProblems {
+	var probs configProblems
+	get := func(k configKey) string {
+		if e, ok := vals[k.name]; ok && e.val != "" {
+			return e.val
+		}
+		return k.def
+	}
+	problem := func(k configKey, sev severity, format string, args ...interface{}) {
+		p := configProblem{file: file, key: k.name, sev: sev, msg: fmt.Sprintf(format, args...)}
+		if section != "" {
+			p.key = section + "." + k.name
+		}
+		if e, ok := vals[k.name]; ok {
+			p.file = e.file
+			p.line = e.line
+			p.key = e.key
+		}
+		probs = append(probs, p)
+	}
+
+	for _, k := range keysAll {
+		if k.global {
+			continue
+		}
+		val := get(k)
+		var set []string
+		for _, variant := range secretVariants[k.name] {
+			if get(variant) != "" {
+				set = append(set, variant.name)
+			}
+			if variant == keyTokenFile && get(variant) != "" {
+				if _, err := readSecretFile(get(variant)); err != nil {
+					problem(variant, ERROR, "%v", err)
+				}
+			}
+		}
+		if k.req && val == "" && len(set) == 0 {
+			problem(k, ERROR, "required key missing")
+		}
+		if val != "" {
+			set = append(set, k.name)
+		}
+		if files := make(map[string]bool); len(set) > 1 {
+			// overriding a value from another source is expected
+			for _, name := range set {
+				if e := vals[name]; files[e.file] {
+					problem(k, WARNING, "supplied by more than one of %s in %s; the first one found is used",
+						strings.Join(set, ", "), e.file)
+					break
+				} else {
+					files[e.file] = true
+				}
+			}
+		}
+	}
+
+	hostname := strings.ToLower(get(keyHostname))
+	tld := strings.ToLower(strings.TrimPrefix(get(keyTld), "."))
+	if tld != "" && hostname != "" && !strings.HasSuffix(hostname, "."+tld) {
+		problem(keyTld, ERROR, "hostname %s is not within %s", hostname, tld)
+	}
+
+	switch strings.ToLower(get(keyDetect)) {
+	case detectURL:
+		if get(keyDetectURL) == "" {
+			problem(keyDetect, ERROR, "%s requires %s", detectURL, keyDetectURL.name)
+		}
+	case detectInterface:
+		if get(keyDetectInterface) == "" {
+			problem(keyDetect, ERROR, "%s requires %s", detectInterface, keyDetectInterface.name)
+		}
+	default:
+		if _, ok := vals[keyDetectURL.name]; ok && get(keyDetectURL) != "" {
+			problem(keyDetectURL, WARNING, "ignored unless %s = %s", keyDetect.name, detectURL)
+		}
+		if _, ok := vals[keyDetectInterface.name]; ok && get(keyDetectInterface) != "" {
+			problem(keyDetectInterface, WARNING, "ignored unless %s = %s", keyDetect.name, detectInterface)
+		}
+	}
+
+	if p := get(keyProxy); p != "" && !strings.EqualFold(p, proxyDirect) {
+		if _, err := parseProxy(p); err != nil {
+			problem(keyProxy, ERROR, "%v", err)
+		}
+	}
+
+	if file := get(keyTLSCAFile); file != "" {
+		if err := appendCAFile(x509.NewCertPool(), file); err != nil {
+			problem(keyTLSCAFile, ERROR, "%v", err)
+		}
+	}
+	if dir := get(keyTLSCADir); dir != "" {
+		if err := appendCADir(x509.NewCertPool(), dir); err != nil {
+			problem(keyTLSCADir, ERROR, "%v", err)
+		}
+	}
+	certFile, keyFile := get(keyTLSCertFile), get(keyTLSKeyFile)
+	switch {
+	case certFile != "" && keyFile == "":
+		problem(keyTLSCertFile, ERROR, "requires %s", keyTLSKeyFile.name)
+	case certFile == "" && keyFile != "":
+		problem(keyTLSKeyFile, ERROR, "requires %s", keyTLSCertFile.name)
+	case certFile != "":
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			problem(keyTLSCertFile, ERROR, "%v", err)
+		}
+	}
+	if isTrue(get(keyTLSInsecure)) {
+		problem(keyTLSInsecure, WARNING, "certificate verification is disabled; use only for testing")
+	}
+	if get(keyProto) == "http" {
+		for _, k := range []configKey{keyTLSCAFile, keyTLSCADir, keyTLSMinVersion, keyTLSPin, keyTLSCertFile, keyTLSKeyFile} {
+			if get(k) != "" {
+				problem(k, WARNING, "ignored unless %s = https", keyProto.name)
+			}
+		}
+	}
+
+	if name := get(keyBindInterface); name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			problem(keyBindInterface, WARNING, "no network interface named %s on this machine", name)
+		} else if addr := get(keyBindAddress); addr != "" && !interfaceHasAddr(iface, addr) {
+			problem(keyBindAddress, WARNING, "%s is not an address of %s", addr, name)
+		}
+	}
+
+	if fo := get(keyFailover); fo != "" {
+		if _, err := parseFailover(fo, get(keyFailoverCheck)); err != nil {
+			problem(keyFailover, ERROR, "%v", err)
+		}
+		if _, ok := vals[keyDetect.name]; ok {
+			problem(keyDetect, WARNING, "ignored when %s is set", keyFailover.name)
+		}
+	}
+
+	// the systemd watchdog is pinged after each host
+	var total time.Duration
+	for _, k := range []configKey{keySecretTimeout, keyDetectTimeout, keyUpdateTimeout, keyFailoverTimeout} {
+		if k == keyFailoverTimeout && get(keyFailover) == "" {
+			continue
+		}
+		if ms, err := timeconv.ParseMilliseconds(get(k)); err == nil {
+			total += time.Duration(ms) * time.Millisecond
+		}
+	}
+	if total > watchdogTimeout {
+		problem(keyUpdateTimeout, WARNING, "timeouts for one host add up to %v, longer than the %v systemd watchdog",
+			total, watchdogTimeout)
+	}
+
+	if maint := get(keyMaintenance); maint != "" {
+		var dur time.Duration
+		if ms, err := timeconv.ParseMilliseconds(get(keyMaintDuration)); err == nil {
+			dur = time.Duration(ms) * time.Millisecond
+		}
+		if _, err := parseMaintenance(maint, dur); err != nil && checkValue(TYPEMAINT, maint) == nil {
+			problem(keyMaintenance, ERROR, "%v", err)
+		}
+	} else {
+		for _, k := range []configKey{keyMaintDuration, keyMaintMode, keyMaintTimezone} {
+			if _, ok := vals[k.name]; ok && get(k) != "" && !strings.EqualFold(get(k), k.def) {
+				problem(k, WARNING, "ignored unless %s is set", keyMaintenance.name)
+			}
+		}
+	}
+	return probs
+}
+
+// checkGlobal checks the keys that apply to the whole config.
+func checkGlobal(file string, vals map[string]configEntry) configProblems {
+	var probs configProblems
+	get := func(k configKey) string {
+		if e, ok := vals[k.name]; ok && e.val != "" {
+			return e.val
+		}
+		return k.def
+	}
+	problem := func(k configKey, sev severity, format string, args ...interface{}) {
+		p := configProblem{file: file, key: k.name, sev: sev, msg: fmt.Sprintf(format, args...)}
+		if e, ok := vals[k.name]; ok {
+			p.file = e.file
+			p.line = e.line
+		}
+		probs = append(probs, p)
+	}
+
+	if ms, err := timeconv.ParseMilliseconds(get(keyInterval)); err == nil && ms < 10*timeconv.MillisPerMinute {
+		problem(keyInterval, WARNING, "less than 10 minutes will likely cause TOO_SOON errors")
+	}
+
+	if !isTrue(get(keySyslog)) {
+		for _, k := range []configKey{keySyslogAddress, keySyslogCAFile} {
+			if get(k) != "" {
+				problem(k, WARNING, "ignored unless %s = YES", keySyslog.name)
+			}
+		}
+	} else if get(keySyslogAddress) == "" && !hasSysLog() {
+		problem(keySyslog, ERROR, "local syslog not supported for %s; set %s", runtime.GOOS, keySyslogAddress.name)
+	}
+	if get(keySyslogCAFile) != "" && !strings.HasPrefix(strings.ToLower(get(keySyslogAddress)), "tls://") {
+		problem(keySyslogCAFile, WARNING, "ignored unless %s is a tls:// address", keySyslogAddress.name)
+	}
+	if file := get(keyLogFile); file == "" || isStdLog(file) {
+		for _, k := range []configKey{keyLogMaxSize, keyLogMaxAge} {
+			if get(k) != "" {
+				problem(k, WARNING, "ignored unless %s is a file", keyLogFile.name)
+			}
+		}
+	}
+	return probs
+}
+
+var reHostLabel = regexp.MustCompile(`^[a-zA-Z0-9_]([a-zA-Z0-9-_]{0,61}[a-zA-Z0-9])?$`)
+
+// checkValue returns an error if val is not valid for the key type.
+func checkValue(typ keyType, val string) error {
+	switch typ {
+	case TYPEHOST:
+		return checkHost(val)
+	case TYPEIP:
+		if net.ParseIP(val) == nil {
+			return fmt.Errorf("'%s' is not an IP address", val)
+		}
+	case TYPEBOOL:
+		if !isTrue(val) && !isFalse(val) {
+			return fmt.Errorf("'%s' must be YES/NO, ON/OFF or TRUE/FALSE", val)
+		}
+	case TYPEDURATION:
+		ms, err := timeconv.ParseMilliseconds(val)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid duration: %v", val, err)
+		}
+		if ms <= 0 {
+			return fmt.Errorf("'%s' must be greater than zero", val)
+		}
+	case TYPEPROTO:
+		if val != "http" && val != "https" {
+			return fmt.Errorf("'%s' must be http or https", val)
+		}
+	case TYPEDETECT:
+		switch strings.ToLower(val) {
+		case detectServer, detectURL, detectInterface:
+		default:
+			return fmt.Errorf("'%s' must be one of %s, %s, %s", val, detectServer, detectURL, detectInterface)
+		}
+	case TYPEURL:
+		u, err := url.Parse(val)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid URL: %v", val, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("'%s' must be an absolute http or https URL", val)
+		}
+	case TYPEMAINT:
+		// cron windows also need maintenance_duration, checked by checkCrossField
+		if _, err := parseMaintenance(val, maxMaintDuration); err != nil {
+			return err
+		}
+	case TYPEMAINTMODE:
+		switch strings.ToLower(val) {
+		case maintSuspend, maintOffline:
+		default:
+			return fmt.Errorf("'%s' must be %s or %s", val, maintSuspend, maintOffline)
+		}
+	case TYPETIMEZONE:
+		if _, err := loadTimezone(val); err != nil {
+			return fmt.Errorf("'%s' is not a known time zone", val)
+		}
+	case TYPEINT:
+		if n, err := strconv.Atoi(val); err != nil || n < 1 {
+			return fmt.Errorf("'%s' must be a whole number greater than zero", val)
+		}
+	case TYPEHEALTHCHECK:
+		return checkHealthCheck(val)
+	case TYPETLSVERSION:
+		if _, ok := tlsVersions[val]; !ok {
+			return fmt.Errorf("'%s' must be one of %s", val, strings.Join(tlsVersionNames(), ", "))
+		}
+	case TYPEPIN:
+		_, err := parsePins(val)
+		return err
+	case TYPESIZE:
+		_, err := parseSize(val)
+		return err
+	case TYPESYSLOGADDR:
+		_, _, err := parseSyslogAddress(val)
+		return err
+	case TYPEFACILITY:
+		if _, ok := syslogFacilities[strings.ToLower(val)]; !ok {
+			return fmt.Errorf("'%s' must be one of %s", val, strings.Join(syslogFacilityNames(), ", "))
+		}
+	case TYPESYSLOGFORMAT:
+		switch strings.ToLower(val) {
+		case syslogRFC3164, syslogRFC5424:
+		default:
+			return fmt.Errorf("'%s' must be %s or %s", val, syslogRFC3164, syslogRFC5424)
+		}
+	case TYPELOGFORMAT:
+		switch strings.ToLower(val) {
+		case logFormatText, logFormatJSON, logFormatLogfmt:
+		default:
+			return fmt.Errorf("'%s' must be %s, %s or %s", val, logFormatText, logFormatJSON, logFormatLogfmt)
+		}
+	case TYPEHOSTPATH:
+		if strings.Contains(val, "://") {
+			return fmt.Errorf("'%s' must not include a scheme; use %s", val, keyProto.name)
+		}
+		host := val
+		if i := strings.Index(host, "/"); i != -1 {
+			host = host[:i]
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return checkHost(host)
+		}
+	}
+	return nil
+}
+
+// checkHost returns an error if s is not a syntactically valid DNS name.
+func checkHost(s string) error {
+	name := strings.TrimSuffix(s, ".")
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("'%s' is not a valid hostname", s)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !reHostLabel.MatchString(label) {
+			return fmt.Errorf("'%s' is not a valid hostname", s)
+		}
+	}
+	return nil
+}
+
+// suggestKey returns the known key closest to an unknown key, or an empty
+// string if none is close enough to be a likely typo.
+func suggestKey(key string) string {
+	type candidate struct {
+		name string
+		dist int
+	}
+	var cands []candidate
+	lkey := strings.ToLower(key)
+	for _, k := range keysAll {
+		d := editDistance(lkey, k.name)
+		if d <= 2 || (len(lkey) > 3 && strings.HasPrefix(k.name, lkey)) {
+			cands = append(cands, candidate{name: k.name, dist: d})
+		}
+	}
+	if len(cands) == 0 {
+		return ""
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].dist < cands[j].dist })
+	return cands[0].name
+}
+
+// editDistance returns the Damerau-Levenshtein (optimal string alignment)
+// distance between a and b, so adjacent transpositions count as one edit.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := 0; j <= len(b); j++ {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min3(a, b, c int) int {
+	m := a
+	if b < m {
+		m = b
+	}
+	if c < m {
+		m = c
+	}
+	return m
+}
+
+// interfaceHasAddr returns true if addr is one of the interface's addresses.
+func interfaceHasAddr(iface *net.Interface, addr string) bool {
+	ip := net.ParseIP(addr)
+	addrs, err := iface.Addrs()
+	if err != nil || ip == nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
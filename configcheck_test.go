@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_checkConfig(t *testing.T) {
+	const base = "username = u\ntoken = t\nhostname = office.example.com\n"
+
+	tests := []struct {
+		name string
+		conf string
+		want []string // expected problems, in order
+	}{
+		{name: "valid", conf: base + "interval = 15 minutes\nwildcard = ON\n", want: nil},
+		{name: "missing required", conf: "username = u\n",
+			want: []string{"error: token: required key missing", "error: hostname: required key missing"}},
+		{name: "typo", conf: base + "wildcrad = ON\n",
+			want: []string{`test.conf:4: error: wildcrad: unknown key (did you mean "wildcard"?)`}},
+		{name: "unknown", conf: base + "colour = blue\n",
+			want: []string{"test.conf:4: error: colour: unknown key"}},
+		{name: "bad interval", conf: base + "interval = 11 parsecs\n",
+			want: []string{"test.conf:4: error: interval: '11 parsecs' is not a valid duration"}},
+		{name: "short interval", conf: base + "interval = 1 minute\n",
+			want: []string{"test.conf:4: warning: interval: less than 10 minutes"}},
+		{name: "long timeouts", conf: base + "update_timeout = 15 minutes\n",
+			want: []string{"test.conf:4: warning: update_timeout: timeouts for one host add up to 16m0s, longer than the 15m0s systemd watchdog"}},
+		{name: "bad ip", conf: base + "myip = 1.2.3\n",
+			want: []string{"test.conf:4: error: myip: '1.2.3' is not an IP address"}},
+		{name: "bad proto", conf: base + "proto = ftp\n",
+			want: []string{"test.conf:4: error: proto: 'ftp' must be http or https"}},
+		{name: "url with scheme", conf: base + "url = https://api.example.com/dyn\n",
+			want: []string{"test.conf:4: error: url: 'https://api.example.com/dyn' must not include a scheme"}},
+		{name: "tld mismatch", conf: base + "tld = co.uk\n",
+			want: []string{"test.conf:4: error: tld: hostname office.example.com is not within co.uk"}},
+		{name: "detect url missing", conf: base + "detect = url\n",
+			want: []string{"test.conf:4: error: detect: url requires detect_url"}},
+		{name: "duplicate", conf: base + "hostname = home.example.com\n",
+			want: []string{"test.conf:4: warning: hostname: overrides value defined on line 3"}},
+		{name: "not key/value", conf: base + "wildcard\n",
+			want: []string{"test.conf:4: error: not a key/value pair: 'wildcard'"}},
+		{name: "cron without duration", conf: base + "maintenance = cron 0 18 * * fri\n",
+			want: []string{"test.conf:4: error: maintenance: 'cron 0 18 * * fri': cron windows require maintenance_duration"}},
+		{name: "bad timezone", conf: base + "maintenance = Sat-Sun\nmaintenance_timezone = Mars/Olympus\n",
+			want: []string{"test.conf:5: error: maintenance_timezone: 'Mars/Olympus' is not a known time zone"}},
+		{name: "host sections", conf: "username = u\ntoken = t\n[office]\nhostname = office.example.com\n" +
+			"[home]\nhostname = home.example.com\ntoken_file = /nonexistent\n", want: []string{
+			"test.conf:7: error: home.token_file: secret file: open /nonexistent"}},
+		{name: "host missing hostname", conf: "username = u\ntoken = t\n[office]\nwildcard = ON\n",
+			want: []string{"error: office.hostname: required key missing"}},
+		{name: "global key in host", conf: base + "[office]\nhostname = office.example.com\ninterval = 1 hour\n",
+			want: []string{"test.conf:6: error: office.interval: only allowed at the top level"}},
+		{name: "tls", conf: base + "tls_min_version = 1.4\ntls_ca_file = /nonexistent\ntls_key_file = client.key\ntls_insecure_skip_verify = YES\n",
+			want: []string{
+				"test.conf:4: error: tls_min_version: '1.4' must be one of 1.0, 1.1, 1.2, 1.3",
+				"test.conf:5: error: tls_ca_file: open /nonexistent",
+				"test.conf:6: error: tls_key_file: requires tls_cert_file",
+				"test.conf:7: warning: tls_insecure_skip_verify: certificate verification is disabled"}},
+		{name: "host typo", conf: base + "[office]\nhostnmae = office.example.com\n",
+			want: []string{`test.conf:5: error: office.hostnmae: unknown key (did you mean "office.hostname"?)`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := readConfigEntries(strings.NewReader(tt.conf), "test.conf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			probs := checkConfig(entries)
+			if len(probs) != len(tt.want) {
+				t.Fatalf("checkConfig() = %v, want %v", probs, tt.want)
+			}
+			for i, p := range probs {
+				if !strings.Contains(p.String(), tt.want[i]) {
+					t.Errorf("problem %d = %q, want %q", i, p.String(), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_suggestKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "wildcrad", want: "wildcard"},
+		{key: "hostnme", want: "hostname"},
+		{key: "intreval", want: "interval"},
+		{key: "detect_ur", want: "detect_url"},
+		{key: "Token", want: "token"},
+		{key: "something", want: ""},
+	}
+	for _, tt := range tests {
+		if got := suggestKey(tt.key); got != tt.want {
+			t.Errorf("suggestKey(%s) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
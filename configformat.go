@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/wiggin77/cfg"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config file formats.
+const (
+	formatAuto = "auto" // chosen by file extension
+	formatConf = "conf" // name/value pairs or INI, parsed by the cfg package
+	formatYAML = "yaml"
+	formatTOML = "toml"
+	formatJSON = "json"
+)
+
+// configFormat returns the format of a config file. When format is auto
+// (or empty) it is chosen by file extension, defaulting to conf.
+func configFormat(file string, format string) (string, error) {
+	format = strings.ToLower(format)
+	switch format {
+	case formatConf, formatYAML, formatTOML, formatJSON:
+		return format, nil
+	case formatAuto, "":
+	default:
+		return "", fmt.Errorf("unsupported config format '%s'", format)
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return formatYAML, nil
+	case ".toml":
+		return formatTOML, nil
+	case ".json":
+		return formatJSON, nil
+	}
+	return formatConf, nil
+}
+
+// newFileSource creates a config Source for a file in the specified format.
+func newFileSource(file string, format string) (cfg.Source, error) {
+	format, err := configFormat(file, format)
+	if err != nil {
+		return nil, err
+	}
+	if format == formatConf {
+		return cfg.NewSrcFileFromFilespec(file)
+	}
+	return newSrcStructFile(file, format)
+}
+
+// srcStructFile is a config Source backed by a YAML, TOML or JSON file.
+// Nested tables are flattened to "table.key" names, the same as keys
+// within an INI [section].
+type srcStructFile struct {
+	cfg.AbstractSourceMonitor
+	mutex  sync.Mutex
+	file   string
+	format string
+	props  map[string]string
+	lm     time.Time
+}
+
+func newSrcStructFile(file string, format string) (*srcStructFile, error) {
+	src := &srcStructFile{file: file, format: format}
+	src.SetMonitorFreq(time.Minute)
+	if _, err := src.GetProps(); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// GetProps returns the flattened properties, reloading the file if it
+// has been modified.
+func (src *srcStructFile) GetProps() (map[string]string, error) {
+	lm, err := src.GetLastModified()
+	if err != nil {
+		return nil, err
+	}
+
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+	if src.props == nil || !lm.Equal(src.lm) {
+		props, err := loadStructFile(src.file, src.format)
+		if err != nil {
+			return nil, err
+		}
+		src.props = props
+		src.lm = lm
+	}
+	return src.props, nil
+}
+
+// GetLastModified returns the modification time of the file.
+func (src *srcStructFile) GetLastModified() (time.Time, error) {
+	fi, err := os.Stat(src.file)
+	if err != nil {
+		return time.Now(), err
+	}
+	return fi.ModTime(), nil
+}
+
+// loadStructFile parses a YAML, TOML or JSON file and returns its
+// flattened properties.
+func loadStructFile(file string, format string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	switch format {
+	case formatYAML:
+		err = yaml.Unmarshal(data, &doc)
+	case formatTOML:
+		err = toml.Unmarshal(data, &doc)
+	case formatJSON:
+		err = json.Unmarshal(data, &doc)
+	default:
+		err = fmt.Errorf("unsupported config format '%s'", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	props := make(map[string]string)
+	if err := flattenConfig(doc, "", props); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return props, nil
+}
+
+// flattenConfig adds each value in doc to props. Nested tables add their
+// keys prefixed with the table name and a dot, and a top level "hosts"
+// list of tables adds each table's keys prefixed with its "name". Booleans
+// are converted to the YES/NO or ON/OFF style of the key's default, and
+// lists of scalars are joined with commas.
+func flattenConfig(doc map[string]interface{}, prefix string, props map[string]string) error {
+	for k, v := range doc {
+		name := prefix + k
+		if prefix == "" && k == "hosts" {
+			if err := flattenHosts(v, props); err != nil {
+				return err
+			}
+			continue
+		}
+		if m, ok := toStringMap(v); ok {
+			if err := flattenConfig(m, name+".", props); err != nil {
+				return err
+			}
+			continue
+		}
+		val, err := scalarString(baseKeyName(name), v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		props[name] = val
+	}
+	return nil
+}
+
+// flattenHosts adds the keys of each table in a hosts list, prefixed
+// with the table's name.
+func flattenHosts(v interface{}, props map[string]string) error {
+	var list []interface{}
+	switch arr := v.(type) {
+	case []interface{}:
+		list = arr
+	case []map[string]interface{}:
+		// TOML decodes arrays of tables with their own type
+		for _, m := range arr {
+			list = append(list, m)
+		}
+	default:
+		return fmt.Errorf("hosts: must be a list of tables")
+	}
+	for i, item := range list {
+		m, ok := toStringMap(item)
+		if !ok {
+			return fmt.Errorf("hosts[%d]: must be a table", i)
+		}
+		name, ok := m["name"].(string)
+		if !ok || name == "" || strings.Contains(name, ".") {
+			return fmt.Errorf("hosts[%d]: name must be a non-empty string without dots", i)
+		}
+		delete(m, "name")
+		if err := flattenConfig(m, name+".", props); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// baseKeyName returns the key name without any table prefix.
+func baseKeyName(name string) string {
+	if i := strings.LastIndex(name, "."); i != -1 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// toStringMap returns v as a map with string keys if it is a table.
+// YAML decodes tables with interface{} keys.
+func toStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		sm := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			sm[fmt.Sprintf("%v", k)] = val
+		}
+		return sm, true
+	}
+	return nil, false
+}
+
+// scalarString converts a decoded value to the string form used in
+// conf files.
+func scalarString(key string, v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	case bool:
+		return boolString(key, val), nil
+	case []interface{}:
+		arr := make([]string, 0, len(val))
+		for _, item := range val {
+			if _, ok := toStringMap(item); ok {
+				return "", fmt.Errorf("only the top level hosts key may be a list of tables")
+			}
+			s, err := scalarString(key, item)
+			if err != nil {
+				return "", err
+			}
+			arr = append(arr, s)
+		}
+		return strings.Join(arr, ","), nil
+	case float64:
+		// JSON decodes all numbers as float64; avoid exponents such as 1e+06
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32), nil
+	case int, int64, uint64:
+		return fmt.Sprintf("%v", val), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", v)
+}
+
+// boolString returns the conf file form of a boolean for the named key,
+// e.g. "ON"/"OFF" for wildcard and "YES"/"NO" for most others.
+func boolString(key string, b bool) string {
+	onOff := false
+	for _, k := range keysAll {
+		if k.name == key {
+			onOff = k.def == "ON" || k.def == "OFF"
+			break
+		}
+	}
+	switch {
+	case onOff && b:
+		return "ON"
+	case onOff:
+		return "OFF"
+	case b:
+		return "YES"
+	}
+	return "NO"
+}
+
+// readStructEntries returns the flattened properties of a YAML, TOML or
+// JSON file as config entries, sorted by key. Line numbers are not known.
+func readStructEntries(file string, format string) ([]configEntry, error) {
+	props, err := loadStructFile(file, format)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]configEntry, 0, len(props))
+	for k, v := range props {
+		entries = append(entries, configEntry{file: file, key: k, val: strings.TrimSpace(v)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries, nil
+}
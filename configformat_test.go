@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_configFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"dynip.conf": "username = testuser\ntoken = testtoken\nhostname = test.example.com\n" +
+			"wildcard = ON\nbackmx = YES\ninterval = 20 minutes\n",
+		"dynip.yaml": "username: testuser\ntoken: testtoken\nhostname: test.example.com\n" +
+			"wildcard: true\nbackmx: true\ninterval: 20 minutes\n",
+		"dynip.toml": "username = \"testuser\"\ntoken = \"testtoken\"\nhostname = \"test.example.com\"\n" +
+			"wildcard = true\nbackmx = true\ninterval = \"20 minutes\"\n",
+		"dynip.json": `{"username": "testuser", "token": "testtoken", "hostname": "test.example.com",
+			"wildcard": true, "backmx": "YES", "interval": "20 minutes"}`,
+	}
+	want := map[configKey]string{
+		keyUsername: "testuser",
+		keyToken:    "testtoken",
+		keyHostname: "test.example.com",
+		keyWildcard: "ON",
+		keyBackMx:   "YES",
+		keyInterval: "20 minutes",
+		keyProto:    "https",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			appConfig, err := NewAppConfig(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range want {
+				if got := appConfig.getKeyVal(k); got != v {
+					t.Errorf("%s = %v, want %v", k.name, got, v)
+				}
+			}
+			probs, err := checkConfigFile(file, formatAuto)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(probs) != 0 {
+				t.Errorf("checkConfigFile() = %v, want no problems", probs)
+			}
+		})
+	}
+}
+
+func Test_configFormat(t *testing.T) {
+	tests := []struct {
+		file    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{file: "/etc/dynip.conf", format: formatAuto, want: formatConf},
+		{file: "dynip.yml", format: "", want: formatYAML},
+		{file: "dynip.YAML", format: formatAuto, want: formatYAML},
+		{file: "dynip.toml", format: formatAuto, want: formatTOML},
+		{file: "dynip.json", format: formatAuto, want: formatJSON},
+		{file: "dynip.cfg", format: "json", want: formatJSON},
+		{file: "dynip.conf", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := configFormat(tt.file, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("configFormat(%s, %s) error = %v, wantErr %v", tt.file, tt.format, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("configFormat(%s, %s) = %v, want %v", tt.file, tt.format, got, tt.want)
+		}
+	}
+}
+
+// The published schema must match the keys dynip knows about; run
+// `dynip config schema > dynip.schema.json` after adding keys.
+func Test_schemaUpToDate(t *testing.T) {
+	published, err := ioutil.ReadFile("dynip.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeSchema(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(published, buf.Bytes()) {
+		t.Error("dynip.schema.json is out of date; regenerate with `dynip config schema`")
+	}
+}
+
+func Test_flattenConfig(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"hosts.yaml": "username: u\ntoken: t\nfailover_rise: 1000000\nhosts:\n" +
+			"  - name: home\n    hostname: home.example.com\n    wildcard: true\n" +
+			"  - name: office\n    hostname: office.example.com\n",
+		"hosts.json": `{"username": "u", "token": "t", "failover_rise": 1000000, "hosts": [
+			{"name": "home", "hostname": "home.example.com", "wildcard": true},
+			{"name": "office", "hostname": "office.example.com"}]}`,
+	}
+	want := map[string]string{"username": "u", "token": "t", "failover_rise": "1000000",
+		"home.hostname": "home.example.com", "home.wildcard": "ON", "office.hostname": "office.example.com"}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		writeTestFile(t, file, content)
+		format, _ := configFormat(file, formatAuto)
+		props, err := loadStructFile(file, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(props, want) {
+			t.Errorf("%s: props = %v, want %v", name, props, want)
+		}
+	}
+
+	file := filepath.Join(dir, "webhooks.yaml")
+	writeTestFile(t, file, "hostname: h\nnotify:\n  - url: https://example.com/hook\n")
+	if _, err := loadStructFile(file, formatYAML); err == nil || !strings.Contains(err.Error(), "only the top level hosts key") {
+		t.Errorf("list of tables error = %v", err)
+	}
+}
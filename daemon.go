@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -8,59 +9,363 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/dynip/pkg/dynip"
 )
 
+const defaultInterval = time.Minute * 11
+
+// clock provides the current time and tickers. Production code uses
+// realClock; tests inject a fake to drive the daemon loop deterministically.
+type clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) ticker
+}
+
+// ticker is the subset of time.Ticker used by the daemon.
+type ticker interface {
+	Chan() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                   { return time.Now() }
+func (realClock) NewTicker(d time.Duration) ticker { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) Chan() <-chan time.Time { return t.C }
+
+// updateFunc performs a single IP update; sendUpdate in production.
+type updateFunc func(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) (*dynip.Reply, error)
+
 type daemonOpt struct {
 	appConfig *AppConfig
 	logger    *logrus.Logger
 	exit      chan string
+	clock     clock       // defaults to realClock
+	update    updateFunc  // defaults to sendUpdate
+	offline   updateFunc  // sets a record offline; defaults to sendOffline
+	notifier  *sdNotifier // systemd notifications; nil for none
+
+	// updateOnStart updates all hosts when the daemon starts rather than
+	// waiting for the first tick
+	updateOnStart bool
+}
+
+// daemon holds the state of the update loop between ticks.
+type daemon struct {
+	opt      *daemonOpt
+	log      *logrus.Entry
+	maxSkips int                   // cap on skip so at least one update is attempted per day
+	hosts    map[string]*hostState // keyed by host section name
+}
+
+// hostState tracks backoff for one host, so failures for one host do not
+// delay updates for the others.
+type hostState struct {
+	skip      int  // number of ticks to skip after consecutive failures
+	skipCount int  // number of ticks skipped so far
+	maint     bool // within a maintenance window
+	failing   bool // the last update failed
+
+	failover *failoverState // nil unless the host has failover candidates
 }
 
-// runDaemon loops on updateIP until daemonOpt.exit channel is signaled.
+// runDaemon loops on sendUpdate until daemonOpt.exit channel is signaled or
+// closed. Work in progress at that point, such as an update request, is
+// cancelled.
 func runDaemon(do *daemonOpt) {
-	dur, _ := do.appConfig.Duration(keyInterval.name, time.Minute*11)
-	if dur <= time.Second {
-		do.logger.Errorf("invalid interval (%v); defaulting to 11 minutes", dur)
-		dur = time.Minute * 11
+	if do.clock == nil {
+		do.clock = realClock{}
+	}
+	if do.update == nil {
+		do.update = sendUpdate
+	}
+	if do.offline == nil {
+		do.offline = sendOffline
 	}
-	hostname := do.appConfig.getKeyVal(keyHostname)
+	dur := daemonInterval(do.appConfig, do.logger)
+
+	d := newDaemon(do, dur, do.logger.WithFields(logrus.Fields{"interval": dur}))
+	d.log.Info("Dynip daemon starting")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case msg, ok := <-do.exit:
+			if !ok {
+				msg = "exit channel closed"
+			}
+			d.log.Info("Dynip daemon exiting: ", msg)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	log := do.logger.WithFields(logrus.Fields{"interval": dur, "hostname": hostname})
-	log.Info("Dynip daemon starting")
+	if do.updateOnStart {
+		d.tick(ctx)
+	}
 
-	ticker := time.NewTicker(dur)
+	ticker := do.clock.NewTicker(dur)
 	defer ticker.Stop()
 
-	go signalMon(do.exit)
+	// failover health checks run more often than updates
+	var checks <-chan time.Time
+	if d.hasFailover() {
+		period, _ := do.appConfig.Duration(keyFailoverPeriod.name, time.Second*30)
+		if period <= 0 {
+			period = time.Second * 30
+		}
+		checkTicker := do.clock.NewTicker(period)
+		defer checkTicker.Stop()
+		checks = checkTicker.Chan()
+	}
+
+	// the systemd watchdog is also pinged after each host in tick, so a
+	// hung update gets the service restarted however many hosts there are
+	var pings <-chan time.Time
+	if interval := do.notifier.pingInterval(); interval > 0 {
+		pingTicker := do.clock.NewTicker(interval)
+		defer pingTicker.Stop()
+		pings = pingTicker.Chan()
+		_ = do.notifier.ping()
+	}
 
-	var err error
-	var result Result
-	var skip, skipCount int
-	var maxSkips = int((time.Hour * 24) / dur)
 	for {
 		select {
-		case msg := <-do.exit:
-			log.Info("Dynip daemon exiting: ", msg)
+		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			if skipCount >= skip {
-				skipCount = 0
-				log.Info("Dynip updating IP")
-				result, err = updateIP(do.appConfig, do.logger)
-				if err == nil {
-					skip = 0
-					log.WithFields(logrus.Fields{"result": result}).Info("ip update successful")
-				} else if skip < maxSkips {
-					skip++
-					log.WithFields(logrus.Fields{"result": result, "err": err}).Error("ip update failed")
-				}
-			} else {
-				skipCount++
-				log.WithFields(logrus.Fields{
-					"skips_remaining": skip - skipCount}).Info("Skipping due to previous errors")
+		case <-ticker.Chan():
+			d.tick(ctx)
+		case <-checks:
+			d.checkFailover(ctx)
+		case <-pings:
+			d.ping()
+		}
+	}
+}
+
+// hasFailover returns true if any host has failover candidates.
+func (d *daemon) hasFailover() bool {
+	for _, host := range d.opt.appConfig.hosts() {
+		if host.getKeyVal(keyFailover) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hostState returns the state of a host, creating it on first use.
+func (d *daemon) hostState(host *AppConfig) *hostState {
+	state, ok := d.hosts[host.hostName()]
+	if !ok {
+		state = &hostState{}
+		d.hosts[host.hostName()] = state
+	}
+	return state
+}
+
+// newDaemon creates a daemon with no pending skips.
+func newDaemon(do *daemonOpt, interval time.Duration, log *logrus.Entry) *daemon {
+	return &daemon{
+		opt:      do,
+		log:      log,
+		maxSkips: int((time.Hour * 24) / interval),
+		hosts:    make(map[string]*hostState),
+	}
+}
+
+// tick updates each host in turn. The host list is read on every tick so
+// hosts added to or removed from the config are picked up. Returns the
+// number of updates attempted.
+func (d *daemon) tick(ctx context.Context) int {
+	count := 0
+	for _, host := range d.opt.appConfig.hosts() {
+		if ctx.Err() != nil {
+			break
+		}
+		state := d.hostState(host)
+		log := d.log.WithField("hostname", host.getKeyVal(keyHostname))
+		if d.maintenance(ctx, host, state, log) {
+			continue
+		}
+		d.failover(ctx, host, state, log, false)
+		if d.tickHost(ctx, host, state, log) {
+			count++
+		}
+		d.ping()
+	}
+	return count
+}
+
+// ping pings the systemd watchdog, if enabled.
+func (d *daemon) ping() {
+	if d.opt.notifier.pingInterval() == 0 {
+		return
+	}
+	if err := d.opt.notifier.ping(); err != nil {
+		d.log.WithField("err", err).Warn("systemd watchdog ping failed")
+	}
+}
+
+// tickHost either performs an update for a host or skips it when backing
+// off from previous errors. Each consecutive failure adds one more skipped
+// tick, up to maxSkips. An update cancelled because the daemon is stopping
+// is not counted as a failure. Returns true if an update was attempted.
+func (d *daemon) tickHost(ctx context.Context, host *AppConfig, state *hostState, log *logrus.Entry) bool {
+	if state.skipCount < state.skip {
+		state.skipCount++
+		log.WithFields(logrus.Fields{
+			"skips_remaining": state.skip - state.skipCount}).Info("Skipping due to previous errors")
+		return false
+	}
+
+	state.skipCount = 0
+	log.Info("Dynip updating IP")
+	reply, err := d.opt.update(ctx, host, d.opt.logger)
+	fields := replyFields(reply)
+	if err != nil && ctx.Err() != nil {
+		log.WithFields(fields).WithField("err", err).Warn("ip update cancelled")
+		return true
+	}
+	status := fmt.Sprintf("%s: %s", host.getKeyVal(keyHostname), reply.Result)
+	if reply.IP != "" {
+		status += " " + reply.IP
+	}
+	_ = d.opt.notifier.status(status + " at " + time.Now().Format("2006-01-02 15:04:05"))
+	if err == nil {
+		state.skip = 0
+		state.failing = false
+		log.WithFields(fields).Info("ip update successful")
+		if reply.Result == dynip.SUCCESS {
+			notifyReply(ctx, host, log, eventUpdated, reply, nil)
+		}
+	} else {
+		// notify once per run of failures rather than on every retry
+		if !state.failing {
+			notifyReply(ctx, host, log, eventUpdateFail, reply, err)
+		}
+		state.failing = true
+		if state.skip < d.maxSkips {
+			state.skip++
+		}
+		log.WithFields(fields).WithField("err", err).Error("ip update failed")
+	}
+	return true
+}
+
+// checkFailover runs the health checks of every failover host and, when a
+// host's chosen address changes, updates it straight away.
+func (d *daemon) checkFailover(ctx context.Context) {
+	for _, host := range d.opt.appConfig.hosts() {
+		if ctx.Err() != nil {
+			break
+		}
+		state := d.hostState(host)
+		log := d.log.WithField("hostname", host.getKeyVal(keyHostname))
+		if d.failover(ctx, host, state, log, true) && !state.maint {
+			d.tickHost(ctx, host, state, log)
+		}
+	}
+}
+
+// failover sets the address to publish for a failover host, running the
+// health checks first if check is true or none have run yet. Returns true
+// if the chosen address changed.
+func (d *daemon) failover(ctx context.Context, host *AppConfig, state *hostState, log *logrus.Entry, check bool) bool {
+	fc, err := host.failover()
+	if err != nil {
+		log.WithField("err", err).Error("invalid failover config")
+		return false
+	}
+	if fc == nil {
+		state.failover = nil
+		return false
+	}
+	if state.failover == nil {
+		state.failover = &failoverState{}
+		check = true
+	}
+	fs := state.failover
+	if check {
+		fc.check(ctx, fs)
+		if ctx.Err() != nil {
+			// results of interrupted checks are not meaningful
+			return false
+		}
+	}
+
+	changed := false
+	if addr := fs.choose(); addr != fs.selected {
+		msg := fmt.Sprintf("failover: publishing %s", addr)
+		if fs.selected != "" {
+			msg = fmt.Sprintf("failover: publishing %s instead of %s", addr, fs.selected)
+		}
+		log.Warn(msg)
+		notify(ctx, host, log, eventFailover, msg)
+		fs.selected = addr
+		changed = true
+	}
+	host.selectedIP = fs.selected
+	if fs.selected == "" {
+		log.Error("failover: no candidate has passed its health check")
+	}
+	return changed
+}
+
+// maintenance checks the host's maintenance windows, logging and notifying
+// when a window starts or ends. In offline mode the record is set offline
+// as the window starts. Returns true while within a window, when the host
+// should not be updated.
+func (d *daemon) maintenance(ctx context.Context, host *AppConfig, state *hostState, log *logrus.Entry) bool {
+	sched, err := host.maintenance()
+	if err != nil {
+		log.WithField("err", err).Error("invalid maintenance schedule; ignoring")
+		return false
+	}
+	in := sched != nil && sched.contains(d.opt.clock.Now())
+
+	switch {
+	case in && !state.maint:
+		state.maint = true
+		msg := "maintenance window started; updates suspended"
+		if sched.mode == maintOffline {
+			msg = "maintenance window started; setting offline"
+		}
+		log.Info(msg)
+		notify(ctx, host, log, eventMaintStart, msg)
+		if sched.mode == maintOffline {
+			if reply, err := d.opt.offline(ctx, host, d.opt.logger); err != nil {
+				log.WithFields(replyFields(reply)).WithField("err", err).Error("set offline failed")
 			}
 		}
+	case !in && state.maint:
+		state.maint = false
+		msg := "maintenance window ended; resuming updates"
+		log.Info(msg)
+		notify(ctx, host, log, eventMaintEnd, msg)
+		// update straight away rather than continuing a backoff
+		state.skip = 0
+		state.skipCount = 0
+	case in:
+		log.Debug("skipping update during maintenance window")
+	}
+	return in
+}
+
+// daemonInterval returns the configured update interval, falling back
+// to the default when the value is too small.
+func daemonInterval(appConfig *AppConfig, logger *logrus.Logger) time.Duration {
+	dur, _ := appConfig.Duration(keyInterval.name, defaultInterval)
+	if dur <= time.Second {
+		logger.Errorf("invalid interval (%v); defaulting to 11 minutes", dur)
+		dur = defaultInterval
 	}
+	return dur
 }
 
 func signalMon(exit chan<- string) {
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/cfg"
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) NewTicker(d time.Duration) ticker {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	t := &fakeTicker{d: d, c: make(chan time.Time)}
+	fc.tickers = append(fc.tickers, t)
+	return t
+}
+
+// advance moves the clock forward by one interval of the first ticker and
+// delivers the tick. Blocks until the daemon loop receives it.
+func (fc *fakeClock) advance() {
+	fc.mu.Lock()
+	t := fc.tickers[0]
+	fc.now = fc.now.Add(t.d)
+	now := fc.now
+	fc.mu.Unlock()
+	t.c <- now
+}
+
+type fakeTicker struct {
+	d       time.Duration
+	c       chan time.Time
+	stopped bool
+}
+
+func (ft *fakeTicker) Chan() <-chan time.Time { return ft.c }
+func (ft *fakeTicker) Stop()                  { ft.stopped = true }
+
+// scriptedUpdater returns the scripted errors in order, then succeeds.
+type scriptedUpdater struct {
+	errs  []error
+	calls int
+}
+
+func (su *scriptedUpdater) update(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) (*dynip.Reply, error) {
+	su.calls++
+	if len(su.errs) == 0 {
+		return &dynip.Reply{Result: dynip.SUCCESS}, nil
+	}
+	err := su.errs[0]
+	su.errs = su.errs[1:]
+	if err != nil {
+		return &dynip.Reply{Result: dynip.SERVERERROR}, err
+	}
+	return &dynip.Reply{Result: dynip.SUCCESS}, nil
+}
+
+func makeDaemonTestOpt(t *testing.T, interval string, update updateFunc) *daemonOpt {
+	cfg, err := NewAppConfigFromMap(map[string]string{
+		"hostname": "test.example.com",
+		"username": "testuser",
+		"token":    "testtoken",
+		"interval": interval,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlog := logrus.New()
+	tlog.Out = ioutil.Discard
+	return &daemonOpt{
+		appConfig: cfg,
+		logger:    tlog,
+		exit:      make(chan string),
+		clock:     &fakeClock{},
+		update:    update,
+	}
+}
+
+func Test_daemon_tick(t *testing.T) {
+	fail := errors.New("fail")
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		errs     []error
+		want     string // one char per tick: 'U' update attempted, '.' skipped
+	}{
+		{name: "always ok", interval: time.Minute * 11, errs: nil, want: "UUUU"},
+		{name: "backoff then recover", interval: time.Minute * 11,
+			errs: []error{fail, fail, nil, nil}, want: "U.U..UU"},
+		{name: "backoff capped", interval: time.Hour * 12,
+			errs: []error{fail, fail, fail, fail, fail}, want: "U.U..U..U..U"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			su := &scriptedUpdater{errs: tt.errs}
+			do := makeDaemonTestOpt(t, "11 minutes", su.update)
+			d := newDaemon(do, tt.interval, do.logger.WithField("test", tt.name))
+
+			got := make([]byte, 0, len(tt.want))
+			for range tt.want {
+				if d.tick(context.Background()) > 0 {
+					got = append(got, 'U')
+				} else {
+					got = append(got, '.')
+				}
+			}
+			if string(got) != tt.want {
+				t.Errorf("tick sequence = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// waitForTicker waits for the daemon loop to create its ticker.
+func waitForTicker(fc *fakeClock) {
+	for {
+		fc.mu.Lock()
+		n := len(fc.tickers)
+		fc.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_runDaemon(t *testing.T) {
+	calls := make(chan struct{}, 10)
+	update := func(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) (*dynip.Reply, error) {
+		calls <- struct{}{}
+		return &dynip.Reply{Result: dynip.SUCCESS}, nil
+	}
+	do := makeDaemonTestOpt(t, "20 minutes", update)
+	fc := do.clock.(*fakeClock)
+
+	done := make(chan struct{})
+	go func() {
+		runDaemon(do)
+		close(done)
+	}()
+	waitForTicker(fc)
+
+	for i := 0; i < 3; i++ {
+		fc.advance()
+		<-calls
+	}
+	do.exit <- "test done"
+	<-done
+
+	if len(calls) != 0 {
+		t.Errorf("%d unexpected update calls", len(calls))
+	}
+	tk := fc.tickers[0]
+	if tk.d != time.Minute*20 {
+		t.Errorf("ticker interval = %v, want %v", tk.d, time.Minute*20)
+	}
+	if !tk.stopped {
+		t.Error("ticker not stopped on exit")
+	}
+}
+
+func Test_runDaemonCancel(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	update := func(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) (*dynip.Reply, error) {
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return &dynip.Reply{Result: dynip.LOCALERROR}, ctx.Err()
+	}
+	do := makeDaemonTestOpt(t, "20 minutes", update)
+	fc := do.clock.(*fakeClock)
+
+	done := make(chan struct{})
+	go func() {
+		runDaemon(do)
+		close(done)
+	}()
+	waitForTicker(fc)
+
+	fc.advance()
+	<-started
+	close(do.exit)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("daemon did not stop while an update was in progress")
+	}
+	if err := <-cancelled; err != context.Canceled {
+		t.Errorf("update context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func Test_daemonInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval string
+		want     time.Duration
+	}{
+		{name: "minutes", interval: "15 minutes", want: time.Minute * 15},
+		{name: "hours", interval: "2h", want: time.Hour * 2},
+		{name: "too small", interval: "500 ms", want: defaultInterval},
+		{name: "zero", interval: "0", want: defaultInterval},
+		{name: "bad units", interval: "5 fortnights", want: defaultInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			do := makeDaemonTestOpt(t, tt.interval, nil)
+			if got := daemonInterval(do.appConfig, do.logger); got != tt.want {
+				t.Errorf("daemonInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_daemonNotifyUpdates(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("notify test uses /bin/sh")
+	}
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "notify.log")
+	replies := []*dynip.Reply{
+		{Result: dynip.SUCCESS, Code: "OK", Message: "test.example.com updated to 203.0.113.5", IP: "203.0.113.5"},
+		{Result: dynip.NOCHANGE, Code: "OK", Message: "no update required for test.example.com to 203.0.113.5"},
+		{Result: dynip.TOOSOON, Code: "TOO_FREQ", Message: "Increase your time between updates"},
+		{Result: dynip.TOOSOON, Code: "TOO_FREQ", Message: "Increase your time between updates"},
+	}
+	update := func(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) (*dynip.Reply, error) {
+		reply := replies[0]
+		replies = replies[1:]
+		if !reply.Result.Success() {
+			return reply, errors.New(string(reply.Result))
+		}
+		return reply, nil
+	}
+	do := makeDaemonTestOpt(t, "11 minutes", update)
+	do.appConfig.PrependSource(cfg.NewSrcMapFromMap(map[string]string{
+		"notify_command": `echo "$NOTIFY_EVENT $NOTIFY_RESULT $NOTIFY_CODE $NOTIFY_IP $NOTIFY_MESSAGE" >> ` + out,
+	}))
+	// no backoff, so every tick updates
+	d := newDaemon(do, time.Hour*24, do.logger.WithField("test", "notify"))
+	d.maxSkips = 0
+
+	want := []string{
+		"updated SUCCESS OK 203.0.113.5 test.example.com updated to 203.0.113.5",
+		"update_failed TOO_SOON TOO_FREQ  Increase your time between updates",
+	}
+	for i := 0; i < 4; i++ {
+		d.tick(context.Background())
+		// notifications run in the background; wait for each before the next
+		n := map[int]int{0: 1, 1: 1, 2: 2, 3: 2}[i]
+		for start := time.Now(); time.Since(start) < time.Second*5; time.Sleep(time.Millisecond * 10) {
+			if b, _ := ioutil.ReadFile(out); strings.Count(string(b), "\n") >= n {
+				break
+			}
+		}
+	}
+	time.Sleep(time.Millisecond * 100)
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Split(strings.TrimSpace(string(b)), "\n"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("notifications:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
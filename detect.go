@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+// Methods for detecting the IP address to publish.
+const (
+	// detectServer leaves detection to the provider; myip is sent as configured.
+	detectServer = "server"
+	// detectURL fetches detect_url and expects an IP address as the response body.
+	detectURL = "url"
+	// detectInterface uses the first global unicast address of detect_interface.
+	detectInterface = "interface"
+)
+
+// detectIP returns the IP address found using the configured detection
+// method, or an empty string when detection is left to the provider.
+func detectIP(ctx context.Context, appConfig *AppConfig) (string, error) {
+	// failover hosts publish the highest priority healthy candidate
+	if appConfig.selectedIP != "" {
+		return appConfig.selectedIP, nil
+	}
+	fc, err := appConfig.failover()
+	if err != nil {
+		return "", err
+	}
+	if fc != nil {
+		return selectFailover(ctx, fc)
+	}
+
+	method := strings.ToLower(appConfig.getKeyVal(keyDetect))
+	switch method {
+	case detectServer, "":
+		return "", nil
+	case detectURL:
+		return detectFromURL(ctx, appConfig, appConfig.getKeyVal(keyDetectURL))
+	case detectInterface:
+		return detectFromInterface(appConfig.getKeyVal(keyDetectInterface))
+	default:
+		return "", fmt.Errorf("unknown detect method '%s'", method)
+	}
+}
+
+// detectFromURL fetches the URL and parses the response body as an IP address.
+func detectFromURL(ctx context.Context, appConfig *AppConfig, url string) (string, error) {
+	if url == "" {
+		return "", fmt.Errorf("detect = %s requires %s", detectURL, keyDetectURL.name)
+	}
+	client, err := newHTTPClient(appConfig, appConfig.timeout(keyDetectTimeout))
+	if err != nil {
+		return "", err
+	}
+	return (&dynip.URLDetector{URL: url, Client: client}).Detect(ctx)
+}
+
+// detectFromInterface returns the first global unicast address of the named
+// network interface, preferring IPv4.
+func detectFromInterface(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("detect = %s requires %s", detectInterface, keyDetectInterface.name)
+	}
+	return dynip.InterfaceAddr(name)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+// dryRunReport describes what a one-shot update would do, without
+// contacting the provider.
+type dryRunReport struct {
+	Hostname   string `json:"hostname"`
+	Provider   string `json:"provider"`
+	DetectedIP string `json:"detected_ip"`
+	SentIP     string `json:"sent_ip"`
+	Request    string `json:"request"`
+	Decision   string `json:"decision"`
+	Reason     string `json:"reason"`
+	Error      string `json:"error,omitempty"`
+
+	err error
+}
+
+// decisionText describes each decision for text output.
+var decisionText = map[dynip.Decision]string{
+	dynip.DecisionUpdate:    "would update",
+	dynip.DecisionUnchanged: "skip because unchanged",
+	dynip.DecisionBlocked:   "blocked by policy",
+	dynip.DecisionOffline:   "skip because offline",
+}
+
+// dryRunReports holds the dry run report for each host.
+type dryRunReports []*dryRunReport
+
+// dryRun performs detection and builds the update request for each host
+// exactly as a one-shot update would, then reports the decisions without
+// sending them.
+func dryRun(o *cliOpts) dryRunReports {
+	appConfig, err := o.loadConfig()
+	if err != nil {
+		report := &dryRunReport{Provider: providerName}
+		report.setErr(err)
+		return dryRunReports{report}
+	}
+	var reports dryRunReports
+	for _, host := range appConfig.hosts() {
+		reports = append(reports, dryRunHost(host))
+	}
+	return reports
+}
+
+// dryRunHost reports the decision for a single host.
+func dryRunHost(appConfig *AppConfig) *dryRunReport {
+	report := &dryRunReport{Provider: providerName}
+	report.Hostname = appConfig.getKeyVal(keyHostname)
+
+	plan, err := makePlan(context.Background(), appConfig)
+	if err != nil {
+		report.setErr(err)
+		return report
+	}
+	report.DetectedIP = plan.DetectedIP
+	report.SentIP = plan.SentIP
+	report.Request = makeRedactedURL(appConfig, plan.SentIP)
+	report.Decision = string(plan.Decision)
+	report.Reason = plan.Reason
+	return report
+}
+
+func (report *dryRunReport) setErr(err error) {
+	report.err = err
+	if err != nil {
+		report.Error = err.Error()
+	}
+}
+
+// exitCode returns zero if the dry run completed, otherwise the exit
+// code for a local error.
+func (report *dryRunReport) exitCode() int {
+	if report.err != nil {
+		return dynip.LOCALERROR.ExitCode()
+	}
+	return 0
+}
+
+// writeText outputs the report to w as aligned name/value lines.
+func (report *dryRunReport) writeText(w io.Writer) error {
+	if report.err != nil {
+		_, err := fmt.Fprintln(w, report.err)
+		return err
+	}
+	detected := report.DetectedIP
+	if detected == "" {
+		detected = "(by provider)"
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(tw, "hostname:\t%s\n", report.Hostname)
+	fmt.Fprintf(tw, "provider:\t%s\n", report.Provider)
+	fmt.Fprintf(tw, "detected ip:\t%s\n", detected)
+	fmt.Fprintf(tw, "sent ip:\t%s\n", report.SentIP)
+	fmt.Fprintf(tw, "request:\t%s\n", report.Request)
+	fmt.Fprintf(tw, "decision:\t%s\n", decisionText[dynip.Decision(report.Decision)])
+	fmt.Fprintf(tw, "reason:\t%s\n", report.Reason)
+	return tw.Flush()
+}
+
+// writeJSON outputs the report to w as an indented JSON document.
+func (report *dryRunReport) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(report)
+}
+
+// exitCode returns the first non-zero exit code of the reports.
+func (reports dryRunReports) exitCode() int {
+	for _, report := range reports {
+		if code := report.exitCode(); code != 0 {
+			return code
+		}
+	}
+	return 0
+}
+
+// writeText outputs each report, separated by blank lines.
+func (reports dryRunReports) writeText(w io.Writer) error {
+	for i, report := range reports {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if err := report.writeText(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON outputs a single report as a JSON object, or multiple reports
+// as a JSON array.
+func (reports dryRunReports) writeJSON(w io.Writer) error {
+	if len(reports) == 1 {
+		return reports[0].writeJSON(w)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(reports)
+}
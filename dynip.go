@@ -1,19 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"runtime/debug"
-	"strings"
-	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/dynip/pkg/dynip"
 )
 
-// updateIP makes one HTTP(S) request to Dynamic IP server then returns the result.
-func updateIP(appConfig *AppConfig, logger *logrus.Logger) (Result, error) {
-	var err error
+// providerName identifies the Dynamic DNS service dynip talks to.
+var providerName = (&dynip.EasyDNS{}).Name()
+
+// sendUpdate makes one HTTP(S) request to Dynamic IP server then returns the
+// result along with the server message and reported IP address.
+func sendUpdate(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) (reply *dynip.Reply, err error) {
+	reply = &dynip.Reply{Result: dynip.LOCALERROR}
+	log := logger.WithField("hostname", appConfig.getKeyVal(keyHostname))
+	defer func() {
+		recordHistory(appConfig, log, historyUpdate, reply, err)
+	}()
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Panicf("Panic: %s\n%s", r, debug.Stack())
@@ -25,133 +31,127 @@ func updateIP(appConfig *AppConfig, logger *logrus.Logger) (Result, error) {
 		}
 	}()
 
-	log := logger.WithField("hostname", appConfig.getKeyVal(keyHostname))
-	timeout := time.Second * 90
-	client := http.Client{
-		Timeout: timeout,
-	}
-
-	url := makeURL(appConfig)
-
-	req, err := http.NewRequest("GET", url, nil)
+	plan, err := makePlan(ctx, appConfig)
 	if err != nil {
-		return LOCALERROR, err
+		if dynip.IsProxyError(err) {
+			reply.Result = dynip.PROXYERROR
+		}
+		return reply, err
 	}
-
-	log.Debug("request: ", url)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return LOCALERROR, err
+	reply.Plan = plan
+	if plan.Decision != dynip.DecisionUpdate {
+		if plan.Decision != dynip.DecisionBlocked {
+			log.Debug("update skipped: ", plan.Reason)
+		}
+		return newClient(appConfig).Send(ctx, newHost(appConfig), plan)
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	token, err := appConfig.getSecretContext(ctx, keyToken)
 	if err != nil {
-		return LOCALERROR, err
+		return reply, err
 	}
-
-	bodyTxt := string(body)
-	log.Debug("response: ", bodyTxt)
-
-	success, result := parseResponse(bodyTxt)
-	if !success {
-		return result, fmt.Errorf("%v", result)
+	reply, err = sendRequest(ctx, appConfig, log, plan.SentIP, token)
+	if reply.Result == dynip.NOAUTH {
+		// the token may have been rotated since it was cached
+		appConfig.invalidateSecret(keyToken)
+		if fresh, ferr := appConfig.getSecretContext(ctx, keyToken); ferr == nil && fresh != token {
+			log.Info("token rejected; retrying with re-fetched token")
+			reply, err = sendRequest(ctx, appConfig, log, plan.SentIP, fresh)
+		}
 	}
-	return result, nil
+	reply.Plan = plan
+	return reply, err
 }
 
-func makeURL(appConfig *AppConfig) string {
-	var sb strings.Builder
-
-	sb.WriteString(appConfig.getKeyVal(keyProto))
-	sb.WriteString("://")
-	sb.WriteString(appConfig.getKeyVal(keyUsername))
-	sb.WriteString(":")
-	sb.WriteString(appConfig.getKeyVal(keyToken))
-	sb.WriteString("@")
-	sb.WriteString(appConfig.getKeyVal(keyURL))
-	sb.WriteString("?")
-
-	keys := appConfig.getKeys()
-	for _, k := range keys {
-		val := appConfig.getKeyVal(k)
-		if shouldInc(k.inc, val) {
-			sb.WriteString(k.name)
-			sb.WriteString("=")
-			sb.WriteString(val)
-			sb.WriteString("&")
-		}
+// sendRequest sends the update request using the specified IP address and token.
+func sendRequest(ctx context.Context, appConfig *AppConfig, log *logrus.Entry, myip string, token string) (*dynip.Reply, error) {
+	provider, err := newProvider(appConfig)
+	if err != nil {
+		return &dynip.Reply{Result: dynip.LOCALERROR}, err
 	}
-	return sb.String()
-}
+	host := newHost(appConfig)
+	host.Token = token
 
-func shouldInc(rule incRule, val string) bool {
-	switch rule {
-	case NEVER:
-		return false
-	case ALWAYS:
-		return true
-	case NOTEMPTY:
-		return len(val) > 0
-	case NOTFALSE:
-		return !isFalse(val)
-	default:
-		return false
+	log.Debug("request: ", makeRedactedURL(appConfig, myip))
+	reply, err := provider.Update(ctx, host, myip)
+	if reply.Body != "" {
+		log.Debug("response: ", reply.Body)
 	}
+	return reply, err
 }
 
-func parseResponse(s string) (success bool, result Result) {
-	if strings.Contains(s, ">OK<") || strings.Contains(s, ">NOERROR<") {
-		if strings.Contains(s, " updated to ") {
-			return true, SUCCESS
-		}
-		return true, NOCHANGE
+// replyFields returns the log fields describing a reply: the result and,
+// when present, the server's status code, message and reported address.
+func replyFields(reply *dynip.Reply) logrus.Fields {
+	fields := logrus.Fields{"result": reply.Result}
+	if reply.Code != "" {
+		fields["code"] = reply.Code
 	}
-	if strings.Contains(s, ">NO_AUTH<") || strings.Contains(s, ">NOACCESS<") {
-		return false, NOAUTH
+	if reply.Message != "" {
+		fields["message"] = reply.Message
 	}
-	if strings.Contains(s, ">NOSERVICE<") || strings.Contains(s, ">NO_SERVICE<") {
-		return false, NOSERVICE
+	if reply.IP != "" {
+		fields["ip"] = reply.IP
 	}
-	if strings.Contains(s, ">ILLEGAL<") || strings.Contains(s, ">ILLEGAL_INPUT<") {
-		return false, ILLEGALINPUT
+	return fields
+}
+
+// newClient returns a client which plans updates for the host. It has no
+// provider; requests are sent with sendRequest so secrets are only
+// fetched when needed.
+func newClient(appConfig *AppConfig) *dynip.Client {
+	return &dynip.Client{
+		Detector: dynip.DetectorFunc(func(ctx context.Context) (string, error) {
+			return detectIP(ctx, appConfig)
+		}),
+		State:         lookupState{},
+		SkipUnchanged: isTrue(appConfig.getKeyVal(keySkipUnchanged)),
+		PublicOnly:    isTrue(appConfig.getKeyVal(keyPublicOnly)),
 	}
-	if strings.Contains(s, ">TOOSOON<") || strings.Contains(s, ">TOO_FREQ<") {
-		return false, TOOSOON
+}
+
+// newProvider returns the provider for the host, with an HTTP client
+// honouring the bind, proxy, TLS and timeout settings.
+func newProvider(appConfig *AppConfig) (*dynip.EasyDNS, error) {
+	client, err := newUpdateClient(appConfig, appConfig.timeout(keyUpdateTimeout))
+	if err != nil {
+		return nil, err
 	}
-	if strings.Contains(s, ">NO_PARTNER<") || strings.Contains(s, ">NOPARTNER<") {
-		return false, NOPARTNER
+	provider := easyDNS(appConfig)
+	provider.Client = client
+	return provider, nil
+}
+
+// easyDNS returns the provider for the host without an HTTP client.
+func easyDNS(appConfig *AppConfig) *dynip.EasyDNS {
+	return &dynip.EasyDNS{
+		URL:   appConfig.getKeyVal(keyURL),
+		Proto: appConfig.getKeyVal(keyProto),
 	}
-	if strings.Contains(s, ">ERROR<") {
-		return false, SERVERERROR
+}
+
+// newHost returns the library host settings for appConfig. The token is
+// not set.
+func newHost(appConfig *AppConfig) *dynip.Host {
+	return &dynip.Host{
+		Hostname: appConfig.getKeyVal(keyHostname),
+		Username: appConfig.getKeyVal(keyUsername),
+		Tld:      appConfig.getKeyVal(keyTld),
+		MyIP:     appConfig.getKeyVal(keyMyIP),
+		Mx:       appConfig.getKeyVal(keyMx),
+		BackMx:   appConfig.getKeyVal(keyBackMx),
+		Wildcard: appConfig.getKeyVal(keyWildcard),
+		Offline:  appConfig.isOffline(),
 	}
-	return false, UNKNOWN
 }
 
-// Result represents the result code returned from an IP update request.
-type Result string
+// redacted replaces secrets in URLs that are displayed.
+const redacted = "REDACTED"
 
-const (
-	// SUCCESS means the IP address updated successfully
-	SUCCESS Result = "SUCCESS"
-	// NOCHANGE means IP address is already the requested value
-	NOCHANGE Result = "NO_CHANGE"
-	// NOAUTH means password/token incorrect
-	NOAUTH Result = "NO_AUTH"
-	// NOSERVICE means Dynamic DNS is not turned on for this domain
-	NOSERVICE Result = "NO_SERVICE"
-	// ILLEGALINPUT means a request param was invalid
-	ILLEGALINPUT Result = "ILLEGAL_INPUT"
-	// TOOSOON means the request was issued before minimum interval elapsed
-	TOOSOON Result = "TOO_SOON"
-	// NOPARTNER means the request did not include required partner information
-	// or there was an error detecting the partner.
-	NOPARTNER Result = "NO_PARTNER"
-	// SERVERERROR means a generic error occurred on the server
-	SERVERERROR Result = "SERVER_ERROR"
-	// UNKNOWN means the response contained none of the known result codes
-	UNKNOWN Result = "UNKNOWN_RESPONSE"
-	// LOCALERROR means there was a local error
-	LOCALERROR Result = "LOCAL_ERROR"
-)
+// makeRedactedURL returns the update request URL sending myip as the IP
+// address, with the token redacted.
+func makeRedactedURL(appConfig *AppConfig, myip string) string {
+	host := newHost(appConfig)
+	host.Token = redacted
+	return easyDNS(appConfig).RequestURL(host, myip)
+}
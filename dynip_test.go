@@ -1,63 +1,68 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/cfg"
+	"github.com/wiggin77/dynip/pkg/dynip"
+	"github.com/wiggin77/dynip/pkg/dynip/dyniptest"
 )
 
-var response string
-
-func Test_updateIP(t *testing.T) {
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, _ = fmt.Fprintln(w, response)
-	}))
+func Test_sendUpdateResults(t *testing.T) {
+	now := time.Now()
+	fake := dyniptest.NewServer()
+	fake.MinInterval = time.Minute * 10
+	fake.Now = func() time.Time { return now }
+	fake.AddAccount("testuser", "testtoken")
+	fake.AddHost("testuser", "test.example.com", "")
+	ts := httptest.NewServer(fake)
 	defer ts.Close()
 
-	type args struct {
-		appConfig *AppConfig
-		logger    *logrus.Logger
-	}
-
-	cfg, err := makeTestConfig(ts.URL)
-	if err != nil {
-		t.Fatal(err)
-	}
 	tlog := logrus.New()
 	tlog.Level = logrus.InfoLevel
 	tlog.Out = ioutil.Discard
-	targs := args{cfg, tlog}
 
 	tests := []struct {
 		name    string
-		args    args
-		want    Result
+		token   string
+		wait    time.Duration
+		want    dynip.Result
 		wantErr bool
-		resp    string
 	}{
-		{name: "success", args: targs, want: SUCCESS, wantErr: false, resp: respSUCCESS},
-		{name: "no change", args: targs, want: NOCHANGE, wantErr: false, resp: respNOCHANGE},
-		{name: "too soon", args: targs, want: TOOSOON, wantErr: true, resp: respTOOSOON},
-		{name: "bad token", args: targs, want: NOAUTH, wantErr: true, resp: respBADTOKEN},
+		{name: "success", token: "testtoken", want: dynip.SUCCESS, wantErr: false},
+		{name: "no change", token: "testtoken", wait: time.Minute * 11, want: dynip.NOCHANGE, wantErr: false},
+		{name: "too soon", token: "testtoken", wait: time.Minute, want: dynip.TOOSOON, wantErr: true},
+		{name: "bad token", token: "badtoken", wait: time.Minute * 11, want: dynip.NOAUTH, wantErr: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			response = tt.resp
-			got, err := updateIP(tt.args.appConfig, tt.args.logger)
+			appConfig, err := makeTestConfig(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			appConfig.PrependSource(cfg.NewSrcMapFromMap(map[string]string{"token": tt.token}))
+			now = now.Add(tt.wait)
+			reply, err := sendUpdate(context.Background(), appConfig, tlog)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("updateIP() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("sendUpdate() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
-				t.Errorf("updateIP() = %v, want %v", got, tt.want)
+			if reply.Result != tt.want {
+				t.Errorf("sendUpdate() = %v, want %v", reply.Result, tt.want)
 			}
 		})
 	}
+	if rec, _ := fake.Record("test.example.com"); rec.IP != "127.0.0.1" || rec.Updates != 2 {
+		t.Errorf("record = %+v, want 127.0.0.1 after 2 updates", rec)
+	}
 }
 
 func makeTestConfig(surl string) (*AppConfig, error) {
@@ -65,7 +70,7 @@ func makeTestConfig(surl string) (*AppConfig, error) {
 	if err != nil {
 		return nil, err
 	}
-	purl := fmt.Sprintf("%s:%s", uri.Hostname(), uri.Port())
+	purl := fmt.Sprintf("%s:%s%s", uri.Hostname(), uri.Port(), dyniptest.EasyDNSPath)
 
 	m := map[string]string{"url": purl,
 		"proto":    "http",
@@ -81,18 +86,81 @@ const (
 	test.example.com updated to 24.114.104.44<br />
 	</FONT></BODY></HTML>`
 
-	respNOCHANGE = `<HTML><BODY><FONT FACE="sans-serif" SIZE="-1">OK<br />
-	<hr noshade size="1">
-	no update required for aspen.darklake.ca to 24.114.85.179<br />
-	</FONT></BODY></HTML>`
-
-	respTOOSOON = `<HTML><BODY><FONT FACE="sans-serif" SIZE="-1">TOO_FREQ<br />
-	<hr noshade size="1">
-	Increase your time between updates for test.example.com to 600 seconds or more.<br />
-	</FONT></BODY></HTML>`
-
 	respBADTOKEN = `<HTML><BODY><FONT FACE="sans-serif" SIZE="-1">NO_AUTH<br />
 	<hr noshade size="1">
 	Failed login attempt logged: user dlauder77, host test.example.com, from 24.114.82.202<br />
 	</FONT></BODY></HTML>`
 )
+
+func Test_sendUpdate(t *testing.T) {
+	fake := dyniptest.NewServer()
+	fake.AddAccount("testuser", "testtoken")
+	fake.AddHost("testuser", "test.example.com", "")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	appConfig, err := makeTestConfig(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appConfig.PrependSource(cfg.NewSrcMapFromMap(map[string]string{"myip": "24.114.104.44"}))
+	tlog := logrus.New()
+	tlog.Out = ioutil.Discard
+
+	reply, err := sendUpdate(context.Background(), appConfig, tlog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Result != dynip.SUCCESS {
+		t.Errorf("result = %v, want %v", reply.Result, dynip.SUCCESS)
+	}
+	if reply.Code != "OK" {
+		t.Errorf("code = %q, want OK", reply.Code)
+	}
+	if want := "test.example.com updated to 24.114.104.44"; reply.Message != want {
+		t.Errorf("message = %q, want %q", reply.Message, want)
+	}
+	if want := "24.114.104.44"; reply.IP != want {
+		t.Errorf("ip = %q, want %q", reply.IP, want)
+	}
+}
+
+func Test_sendUpdateCancel(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	appConfig, err := makeTestConfig(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlog := logrus.New()
+	tlog.Out = ioutil.Discard
+
+	// cancelled by the caller
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	if _, err := sendUpdate(ctx, appConfig, tlog); err == nil {
+		t.Error("cancelled update should fail")
+	}
+	if d := time.Since(start); d > time.Second*5 {
+		t.Errorf("cancelled update took %v", d)
+	}
+
+	// update_timeout
+	appConfig.PrependSource(cfg.NewSrcMapFromMap(map[string]string{"update_timeout": "100 ms"}))
+	start = time.Now()
+	if _, err := sendUpdate(context.Background(), appConfig, tlog); err == nil {
+		t.Error("update should time out")
+	}
+	if d := time.Since(start); d > time.Second*5 {
+		t.Errorf("update_timeout not applied; took %v", d)
+	}
+}
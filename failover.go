@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// candidate is one address a failover host may publish, in priority order.
+type candidate struct {
+	addr  string // an IP address, or "interface:" plus an interface name
+	check string // health check; see probe
+}
+
+// interfacePrefix marks a candidate whose address is detected from a
+// network interface.
+const interfacePrefix = "interface:"
+
+// parseFailover parses a comma separated list of candidates. Each candidate
+// is an address optionally followed by a space and its own health check,
+// otherwise defCheck is used.
+func parseFailover(val string, defCheck string) ([]candidate, error) {
+	var cands []candidate
+	for _, s := range strings.Split(val, ",") {
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("'%s' must be an address and optional health check", strings.TrimSpace(s))
+		}
+		c := candidate{addr: fields[0], check: defCheck}
+		if len(fields) == 2 {
+			c.check = fields[1]
+		}
+		if strings.HasPrefix(c.addr, interfacePrefix) {
+			if strings.TrimPrefix(c.addr, interfacePrefix) == "" {
+				return nil, fmt.Errorf("'%s' is missing the interface name", c.addr)
+			}
+		} else if net.ParseIP(c.addr) == nil {
+			return nil, fmt.Errorf("'%s' is not an IP address or %sNAME", c.addr, interfacePrefix)
+		}
+		if c.check == "" {
+			return nil, fmt.Errorf("'%s' has no health check and %s is not set", c.addr, keyFailoverCheck.name)
+		}
+		if err := checkHealthCheck(c.check); err != nil {
+			return nil, err
+		}
+		cands = append(cands, c)
+	}
+	if len(cands) == 0 {
+		return nil, fmt.Errorf("no failover candidates")
+	}
+	return cands, nil
+}
+
+// checkHealthCheck returns an error if check is not a supported health
+// check: tcp://host:port, http://... or https://...
+func checkHealthCheck(check string) error {
+	u, err := url.Parse(strings.Replace(check, "{ip}", "127.0.0.1", -1))
+	if err != nil {
+		return fmt.Errorf("health check '%s': %v", check, err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Port() == "" {
+			return fmt.Errorf("health check '%s' must include a port", check)
+		}
+	case "http", "https":
+	default:
+		return fmt.Errorf("health check '%s' must be tcp://, http:// or https://", check)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("health check '%s' must include a host", check)
+	}
+	return nil
+}
+
+// address returns the candidate's IP address, detecting it from the
+// interface if necessary.
+func (c candidate) address() (string, error) {
+	if strings.HasPrefix(c.addr, interfacePrefix) {
+		return detectFromInterface(strings.TrimPrefix(c.addr, interfacePrefix))
+	}
+	return c.addr, nil
+}
+
+// probeFunc runs a health check; replaced in tests.
+var probeFunc = probe
+
+// probe runs a health check for a candidate address. If the check contains
+// "{ip}" it is replaced with the address, so the candidate itself is
+// probed. Otherwise the check's target is probed from the address, which
+// must then be local, so the probe goes out over that link. TCP checks
+// pass when a connection is made; HTTP checks when the status is 2xx or 3xx.
+func probe(ctx context.Context, check string, ip string, timeout time.Duration) error {
+	host := ip
+	if strings.Contains(ip, ":") {
+		host = "[" + ip + "]"
+	}
+	target := strings.Replace(check, "{ip}", host, -1)
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if target == check {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(ip)}
+	}
+
+	if u.Scheme == "tcp" {
+		conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			// each probe has its own transport, so nothing would reuse or
+			// close an idle connection
+			DisableKeepAlives: true,
+		},
+		// a redirect is a sign of life; don't follow it
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return nil
+}
+
+// candHealth tracks the health of one candidate with hysteresis.
+type candHealth struct {
+	known bool // at least one check has completed
+	up    bool
+	count int // consecutive results disagreeing with up
+	addr  string
+}
+
+// failoverState is the health of each candidate of a failover host and
+// the address currently published.
+type failoverState struct {
+	health   []candHealth
+	selected string // address published; empty until one is chosen
+}
+
+// observe records a health check result. A candidate's first result sets
+// its health; after that it takes rise consecutive passes to become
+// healthy and fall consecutive failures to become unhealthy.
+func (fs *failoverState) observe(i int, addr string, ok bool, rise int, fall int) {
+	h := &fs.health[i]
+	if ok {
+		h.addr = addr
+	}
+	if !h.known {
+		h.known = true
+		h.up = ok
+		return
+	}
+	if ok == h.up {
+		h.count = 0
+		return
+	}
+	h.count++
+	if (ok && h.count >= rise) || (!ok && h.count >= fall) {
+		h.up = ok
+		h.count = 0
+	}
+}
+
+// choose returns the address of the highest priority healthy candidate.
+// If none is healthy the current selection is kept.
+func (fs *failoverState) choose() string {
+	for _, h := range fs.health {
+		if h.up && h.addr != "" {
+			return h.addr
+		}
+	}
+	return fs.selected
+}
+
+// failoverConfig holds the failover settings of a host.
+type failoverConfig struct {
+	cands   []candidate
+	rise    int
+	fall    int
+	timeout time.Duration
+}
+
+// failover returns the host's failover settings, or nil if it has none.
+func (config *AppConfig) failover() (*failoverConfig, error) {
+	val := config.getKeyVal(keyFailover)
+	if val == "" {
+		return nil, nil
+	}
+	cands, err := parseFailover(val, config.getKeyVal(keyFailoverCheck))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", keyFailover.name, err)
+	}
+	fc := &failoverConfig{cands: cands}
+	if fc.rise, err = strconv.Atoi(config.getKeyVal(keyFailoverRise)); err != nil || fc.rise < 1 {
+		return nil, fmt.Errorf("%s must be a whole number greater than zero", keyFailoverRise.name)
+	}
+	if fc.fall, err = strconv.Atoi(config.getKeyVal(keyFailoverFall)); err != nil || fc.fall < 1 {
+		return nil, fmt.Errorf("%s must be a whole number greater than zero", keyFailoverFall.name)
+	}
+	if fc.timeout, err = config.Duration(keyFailoverTimeout.name, time.Second*5); err != nil {
+		return nil, fmt.Errorf("%s: %v", keyFailoverTimeout.name, err)
+	}
+	return fc, nil
+}
+
+// check runs the health check of every candidate and records the results.
+func (fc *failoverConfig) check(ctx context.Context, fs *failoverState) {
+	if len(fs.health) != len(fc.cands) {
+		fs.health = make([]candHealth, len(fc.cands))
+	}
+	for i, c := range fc.cands {
+		addr, err := c.address()
+		if err == nil {
+			err = probeFunc(ctx, c.check, addr, fc.timeout)
+		}
+		fs.observe(i, addr, err == nil, fc.rise, fc.fall)
+	}
+}
+
+// selectFailover checks every candidate once, without hysteresis, and
+// returns the address of the highest priority healthy one. It is used for
+// one-shot runs; the daemon keeps a failoverState between checks.
+func selectFailover(ctx context.Context, fc *failoverConfig) (string, error) {
+	fs := &failoverState{}
+	fc.check(ctx, fs)
+	if addr := fs.choose(); addr != "" {
+		return addr, nil
+	}
+	return "", fmt.Errorf("failover: no candidate passed its health check")
+}
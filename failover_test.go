@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+func Test_parseFailover(t *testing.T) {
+	cands, err := parseFailover("interface:ppp0, 198.51.100.7 http://{ip}/health", "tcp://1.1.1.1:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []candidate{
+		{addr: "interface:ppp0", check: "tcp://1.1.1.1:443"},
+		{addr: "198.51.100.7", check: "http://{ip}/health"},
+	}
+	if len(cands) != len(want) || cands[0] != want[0] || cands[1] != want[1] {
+		t.Errorf("parseFailover() = %v, want %v", cands, want)
+	}
+
+	bad := []string{"", "not-an-ip", "interface:", "198.51.100.7 ftp://{ip}", "198.51.100.7 tcp://{ip}", "1.2.3.4 a b"}
+	for _, val := range bad {
+		if _, err := parseFailover(val, "tcp://{ip}:443"); err == nil {
+			t.Errorf("parseFailover(%q) should fail", val)
+		}
+	}
+	if _, err := parseFailover("198.51.100.7", ""); err == nil {
+		t.Error("parseFailover() without any health check should fail")
+	}
+}
+
+func Test_failoverHysteresis(t *testing.T) {
+	// two candidates; rise 3, fall 2
+	fs := &failoverState{health: make([]candHealth, 2)}
+	step := func(a, b bool) string {
+		fs.observe(0, "A", a, 3, 2)
+		fs.observe(1, "B", b, 3, 2)
+		fs.selected = fs.choose()
+		return fs.selected
+	}
+
+	steps := []struct {
+		a, b bool
+		want string
+	}{
+		{true, true, "A"},   // first results set health directly
+		{false, true, "A"},  // one failure is not enough
+		{true, true, "A"},   // failure count reset
+		{false, true, "A"},  //
+		{false, true, "B"},  // second consecutive failure: fail over
+		{true, true, "B"},   // A must pass 3 times before failing back
+		{true, true, "B"},   //
+		{true, true, "A"},   // fail back
+		{false, false, "A"}, //
+		{false, false, "A"}, // both down: keep the last selection
+	}
+	for i, s := range steps {
+		if got := step(s.a, s.b); got != s.want {
+			t.Fatalf("step %d: selected %s, want %s", i, got, s.want)
+		}
+	}
+}
+
+func Test_probe(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ok.Close()
+	port := ok.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		check   string
+		wantErr bool
+	}{
+		{check: "http://{ip}:" + strconv.Itoa(port) + "/health"},
+		{check: "http://{ip}:" + strconv.Itoa(port) + "/down", wantErr: true},
+		{check: "tcp://{ip}:" + strconv.Itoa(port)},
+		// no {ip}: probe the target from the candidate address
+		{check: "tcp://127.0.0.1:" + strconv.Itoa(port)},
+	}
+	for _, tt := range tests {
+		err := probe(context.Background(), tt.check, "127.0.0.1", time.Second*5)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("probe(%s) error = %v, wantErr %v", tt.check, err, tt.wantErr)
+		}
+	}
+
+	ok.Close()
+	if err := probe(context.Background(), "tcp://{ip}:"+strconv.Itoa(port), "127.0.0.1", time.Second); err == nil {
+		t.Error("probe of a closed port should fail")
+	}
+}
+
+func Test_probeCancel(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	port := slow.Listener.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*100, cancel)
+	start := time.Now()
+	if err := probe(ctx, "http://{ip}:"+strconv.Itoa(port)+"/health", "127.0.0.1", time.Second*30); err == nil {
+		t.Error("cancelled probe should fail")
+	}
+	if d := time.Since(start); d > time.Second*5 {
+		t.Errorf("cancelled probe took %v", d)
+	}
+}
+
+func Test_daemonFailover(t *testing.T) {
+	down := map[string]bool{}
+	saved := probeFunc
+	probeFunc = func(ctx context.Context, check string, ip string, timeout time.Duration) error {
+		if down[ip] {
+			return errors.New("down")
+		}
+		return nil
+	}
+	defer func() { probeFunc = saved }()
+
+	cfg, err := NewAppConfigFromMap(map[string]string{
+		"hostname":       "office.example.com",
+		"username":       "testuser",
+		"token":          "testtoken",
+		"failover":       "198.51.100.1, 203.0.113.1",
+		"failover_check": "tcp://{ip}:443",
+		"failover_fall":  "1",
+		"failover_rise":  "2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlog := logrus.New()
+	tlog.Out = ioutil.Discard
+
+	var sent []string
+	update := func(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) (*dynip.Reply, error) {
+		ip, err := detectIP(ctx, appConfig)
+		sent = append(sent, ip)
+		return &dynip.Reply{Result: dynip.SUCCESS}, err
+	}
+	do := &daemonOpt{appConfig: cfg, logger: tlog, clock: &fakeClock{}, update: update}
+	d := newDaemon(do, time.Minute*11, tlog.WithField("test", "failover"))
+
+	d.tick(context.Background())
+	down["198.51.100.1"] = true
+	d.checkFailover(context.Background()) // fails over and updates straight away
+	d.checkFailover(context.Background()) // no change, no update
+	delete(down, "198.51.100.1")
+	d.checkFailover(context.Background()) // first pass; rise is 2
+	d.checkFailover(context.Background()) // fails back
+	d.tick(context.Background())
+
+	want := []string{"198.51.100.1", "203.0.113.1", "198.51.100.1", "198.51.100.1"}
+	if strings.Join(sent, " ") != strings.Join(want, " ") {
+		t.Errorf("published %v, want %v", sent, want)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/cfg/timeconv"
+	"github.com/wiggin77/dynip/pkg/dynip/dyniptest"
+)
+
+// Defaults for `dynip fake-server`.
+const (
+	fakeListen   = "127.0.0.1:8245"
+	fakeAccount  = "test:test"
+	fakeHostname = "test.example.com"
+)
+
+// stringList is a flag which may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// fakeServerOpt holds the `dynip fake-server` options.
+type fakeServerOpt struct {
+	listen      string
+	minInterval string
+	accounts    stringList
+	hosts       stringList
+	noService   stringList
+}
+
+func addFakeServerFlags(fs *flag.FlagSet, opt *fakeServerOpt) {
+	fs.StringVar(&opt.listen, "listen", fakeListen, "address to listen on")
+	fs.Var(&opt.accounts, "account", "account as user:token; may be repeated (default "+fakeAccount+")")
+	fs.Var(&opt.hosts, "host", "hostname as user:hostname or user:hostname=ip; may be repeated (default test:"+fakeHostname+")")
+	fs.Var(&opt.noService, "no-service", "hostname without dynamic DNS enabled; may be repeated")
+	fs.StringVar(&opt.minInterval, "min-interval", "0", "minimum time between updates of a host, e.g. \"10 minutes\"")
+}
+
+// cmdFakeServer runs `dynip fake-server`, a fake provider for integration
+// tests and staging daemons. It serves until interrupted.
+func cmdFakeServer(opt *fakeServerOpt, result *appResult) {
+	fake, err := newFakeServer(opt.accounts, opt.hosts, opt.noService, opt.minInterval)
+	if err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	logger := logrus.New()
+	logger.Out = os.Stderr
+	fake.Logf = logger.Infof
+
+	ln, err := net.Listen("tcp", opt.listen)
+	if err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	addr := ln.Addr().String()
+	logger.Infof("fake provider listening on http://%s", addr)
+	logger.Infof("use url = %s%s and proto = http; records at http://%s%s", addr, dyniptest.EasyDNSPath, addr, dyniptest.RecordsPath)
+
+	srv := &http.Server{Handler: fake}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(c)
+		<-c
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	<-done
+}
+
+// newFakeServer creates the fake provider from the command line values.
+func newFakeServer(accounts []string, hosts []string, noService []string, minInterval string) (*dyniptest.Server, error) {
+	if len(accounts) == 0 {
+		accounts = []string{fakeAccount}
+		if len(hosts) == 0 {
+			hosts = []string{"test:" + fakeHostname}
+		}
+	}
+	fake := dyniptest.NewServer()
+	ms, err := timeconv.ParseMilliseconds(minInterval)
+	if err != nil {
+		return nil, fmt.Errorf("min-interval: %v", err)
+	}
+	fake.MinInterval = time.Duration(ms) * time.Millisecond
+
+	for _, a := range accounts {
+		parts := strings.SplitN(a, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("account '%s' must be user:token", a)
+		}
+		fake.AddAccount(parts[0], parts[1])
+	}
+	for _, h := range hosts {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("host '%s' must be user:hostname or user:hostname=ip", h)
+		}
+		hostname, ip := parts[1], ""
+		if i := strings.Index(hostname, "="); i >= 0 {
+			hostname, ip = hostname[:i], hostname[i+1:]
+			if net.ParseIP(ip) == nil {
+				return nil, fmt.Errorf("host '%s': '%s' is not an IP address", h, ip)
+			}
+		}
+		fake.AddHost(parts[0], hostname, ip)
+	}
+	for _, h := range noService {
+		if _, ok := fake.Record(h); !ok {
+			return nil, fmt.Errorf("no-service host '%s' is not given with -host", h)
+		}
+		fake.SetNoService(h, true)
+	}
+	return fake, nil
+}
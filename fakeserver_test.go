@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_newFakeServer(t *testing.T) {
+	fake, err := newFakeServer(nil, nil, nil, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Record(fakeHostname); !ok {
+		t.Errorf("default host %s missing", fakeHostname)
+	}
+
+	fake, err = newFakeServer([]string{"alice:secret"},
+		[]string{"alice:office.example.com=203.0.113.1", "alice:lab.example.com"},
+		[]string{"lab.example.com"}, "10 minutes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.MinInterval != time.Minute*10 {
+		t.Errorf("MinInterval = %v, want 10m", fake.MinInterval)
+	}
+	if rec, _ := fake.Record("office.example.com"); rec.IP != "203.0.113.1" || rec.Username != "alice" {
+		t.Errorf("office record = %+v", rec)
+	}
+	if rec, _ := fake.Record("lab.example.com"); !rec.NoService {
+		t.Errorf("lab record = %+v, want no service", rec)
+	}
+
+	bad := []struct {
+		accounts, hosts, noService []string
+		interval                   string
+	}{
+		{accounts: []string{"alice"}, interval: "0"},
+		{accounts: []string{"alice:secret"}, hosts: []string{"office.example.com"}, interval: "0"},
+		{accounts: []string{"alice:secret"}, hosts: []string{"alice:office.example.com=bogus"}, interval: "0"},
+		{accounts: []string{"alice:secret"}, noService: []string{"other.example.com"}, interval: "0"},
+		{interval: "soon"},
+	}
+	for _, b := range bad {
+		if _, err := newFakeServer(b.accounts, b.hosts, b.noService, b.interval); err == nil {
+			t.Errorf("newFakeServer(%v, %v, %v, %q) should fail", b.accounts, b.hosts, b.noService, b.interval)
+		}
+	}
+}
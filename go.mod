@@ -3,7 +3,12 @@ module github.com/wiggin77/dynip
 go 1.12
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/kardianos/service v1.0.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/wiggin77/cfg v1.0.2
+	golang.org/x/net v0.11.0
+	golang.org/x/sys v0.10.0
+	golang.org/x/term v0.10.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/cfg/timeconv"
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+// History events.
+const (
+	historyUpdate  = "update"
+	historyOffline = "offline"
+)
+
+// historyEntry is one line of the history journal: the detection, the
+// decision and the provider's reply for one request.
+type historyEntry struct {
+	Time       time.Time    `json:"time"`
+	Host       string       `json:"host"`
+	Event      string       `json:"event"`
+	DetectedIP string       `json:"detected_ip,omitempty"`
+	SentIP     string       `json:"sent_ip,omitempty"`
+	Decision   string       `json:"decision,omitempty"`
+	Reason     string       `json:"reason,omitempty"`
+	Result     dynip.Result `json:"result"`
+	ServerCode string       `json:"server_code,omitempty"`
+	Message    string       `json:"message,omitempty"`
+	IP         string       `json:"ip,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// historyMux serializes writes to the journal within the process; see
+// lockHistory for other processes.
+var historyMux sync.Mutex
+
+// historyFile returns the default history journal for a config file.
+func historyFile(configFile string) string {
+	return configFile + ".history"
+}
+
+// historyPath returns the history journal for the config, or empty string
+// if history is disabled, which is the default. "YES" selects the default
+// journal; a relative history key is relative to the config file's
+// directory.
+func (config *AppConfig) historyPath() string {
+	val := config.getKeyVal(keyHistory)
+	switch {
+	case val == "" || isFalse(val):
+		return ""
+	case isTrue(val):
+		return config.history
+	case !filepath.IsAbs(val) && config.history != "":
+		return filepath.Join(filepath.Dir(config.history), val)
+	}
+	return val
+}
+
+// newHistoryEntry describes the outcome of a request.
+func newHistoryEntry(appConfig *AppConfig, event string, reply *dynip.Reply, err error) *historyEntry {
+	entry := &historyEntry{
+		Time:       time.Now(),
+		Host:       appConfig.getKeyVal(keyHostname),
+		Event:      event,
+		Result:     reply.Result,
+		ServerCode: reply.Code,
+		Message:    reply.Message,
+		IP:         reply.IP,
+	}
+	if plan := reply.Plan; plan != nil {
+		entry.DetectedIP = plan.DetectedIP
+		entry.SentIP = plan.SentIP
+		entry.Decision = string(plan.Decision)
+		entry.Reason = plan.Reason
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// recordHistory appends the outcome of a request to the history journal,
+// if enabled. Failures are logged; they never fail the request.
+func recordHistory(appConfig *AppConfig, log *logrus.Entry, event string, reply *dynip.Reply, err error) {
+	path := appConfig.historyPath()
+	if path == "" {
+		return
+	}
+	maxSize, serr := parseSize(appConfig.getKeyVal(keyHistoryMaxSize))
+	if serr != nil {
+		maxSize, _ = parseSize(keyHistoryMaxSize.def)
+	}
+	maxAge := appConfig.timeout(keyHistoryMaxAge)
+
+	entry := newHistoryEntry(appConfig, event, reply, err)
+	if herr := appendHistory(path, entry, maxSize, maxAge); herr != nil {
+		log.WithField("err", herr).Warn("could not record history")
+	}
+}
+
+// appendHistory adds an entry to the journal, compacting it first when it
+// has grown past maxSize or holds entries older than maxAge.
+func appendHistory(path string, entry *historyEntry, maxSize int64, maxAge time.Duration) error {
+	historyMux.Lock()
+	defer historyMux.Unlock()
+	unlock, err := lockHistory(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if needsCompaction(path, maxSize, entry.Time.Add(-maxAge)) {
+		if err := compactHistory(path, maxSize, entry.Time.Add(-maxAge)); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// lockHistory locks the journal against other processes until the
+// returned func is called. The lock is taken on a separate ".lock" file
+// since compaction replaces the journal.
+func lockHistory(path string) (func(), error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("could not lock %s: %v", f.Name(), err)
+	}
+	return func() { _ = f.Close() }, nil
+}
+
+// needsCompaction returns true if the journal is larger than maxSize or
+// its first (oldest) entry is before cutoff.
+func needsCompaction(path string, maxSize int64, cutoff time.Time) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+	if fi, err := f.Stat(); err == nil && fi.Size() > maxSize {
+		return true
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return false
+	}
+	var entry historyEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return true
+	}
+	return entry.Time.Before(cutoff)
+}
+
+// compactHistory rewrites the journal without entries before cutoff or
+// that cannot be read, then drops the oldest entries until it is no more
+// than three quarters of maxSize, so compaction is not needed on every
+// append.
+func compactHistory(path string, maxSize int64, cutoff time.Time) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var lines [][]byte
+	var size int64
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var entry historyEntry
+		if len(line) == 0 || json.Unmarshal(line, &entry) != nil || entry.Time.Before(cutoff) {
+			continue
+		}
+		lines = append(lines, line)
+		size += int64(len(line)) + 1
+	}
+	for len(lines) > 0 && size > maxSize*3/4 {
+		size -= int64(len(lines[0])) + 1
+		lines = lines[1:]
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, line := range lines {
+		_, _ = w.Write(line)
+		_ = w.WriteByte('\n')
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// readHistory returns the entries in the journal, oldest first. Lines that
+// cannot be read are skipped. A missing journal has no entries.
+func readHistory(path string) ([]*historyEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []*historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := &historyEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// sizeUnits are the multipliers for sizes such as "10 MB".
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1024,
+	"MB": 1024 * 1024,
+	"GB": 1024 * 1024 * 1024,
+}
+
+// parseSize parses a size such as "10 MB", "512KB" or "1048576" (bytes).
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i == -1 {
+		i = len(s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if err != nil || !ok || n < 1 {
+		return 0, fmt.Errorf("'%s' must be a size such as 10 MB", s)
+	}
+	return n * unit, nil
+}
+
+// historyFilter selects journal entries. Zero values match everything.
+type historyFilter struct {
+	hosts   map[string]bool // lower case hostnames
+	since   time.Time
+	until   time.Time
+	results map[dynip.Result]bool
+}
+
+func (hf *historyFilter) match(entry *historyEntry) bool {
+	if len(hf.hosts) > 0 && !hf.hosts[strings.ToLower(entry.Host)] {
+		return false
+	}
+	if !hf.since.IsZero() && entry.Time.Before(hf.since) {
+		return false
+	}
+	if !hf.until.IsZero() && !entry.Time.Before(hf.until) {
+		return false
+	}
+	if len(hf.results) > 0 && !hf.results[entry.Result] {
+		return false
+	}
+	return true
+}
+
+// historyTimeLayouts are the absolute time formats accepted by -since and
+// -until, in local time unless a zone is given.
+var historyTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// parseHistoryTime parses an absolute time such as "2024-03-01" or
+// "2024-03-01 08:30", or a duration such as "30 days" meaning that long
+// before now.
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	for _, layout := range historyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if ms, err := timeconv.ParseMilliseconds(s); err == nil && ms > 0 {
+		return now.Add(-time.Duration(ms) * time.Millisecond), nil
+	}
+	return time.Time{}, fmt.Errorf("'%s' must be a date such as 2024-03-01, a time such as \"2024-03-01 08:30\", or a duration such as \"30 days\"", s)
+}
+
+// parseResults parses a comma separated list of results, case insensitive.
+func parseResults(s string) (map[dynip.Result]bool, error) {
+	results := make(map[dynip.Result]bool)
+	for _, r := range strings.Split(s, ",") {
+		r = strings.ToUpper(strings.TrimSpace(r))
+		if r == "" {
+			continue
+		}
+		res := dynip.Result(r)
+		if res.ExitCode() == dynip.UNKNOWN.ExitCode() && res != dynip.UNKNOWN {
+			return nil, fmt.Errorf("unknown result '%s'", r)
+		}
+		results[res] = true
+	}
+	return results, nil
+}
+
+// Output formats for `dynip history`.
+const outputCSV = "csv"
+
+// historyColumns are the CSV columns, matching the JSON field names.
+var historyColumns = []string{"time", "host", "event", "detected_ip", "sent_ip", "decision", "reason",
+	"result", "server_code", "message", "ip", "error"}
+
+func (entry *historyEntry) csvRecord() []string {
+	return []string{entry.Time.Format(time.RFC3339), entry.Host, entry.Event, entry.DetectedIP, entry.SentIP,
+		entry.Decision, entry.Reason, string(entry.Result), entry.ServerCode, entry.Message, entry.IP, entry.Error}
+}
+
+// writeHistory outputs entries in the given format: text, csv or json.
+func writeHistory(w io.Writer, entries []*historyEntry, format string) error {
+	switch format {
+	case outputJSON:
+		if entries == nil {
+			entries = []*historyEntry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		_ = cw.Write(historyColumns)
+		for _, entry := range entries {
+			_ = cw.Write(entry.csvRecord())
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tHOST\tEVENT\tRESULT\tSENT IP\tIP\tDETAIL")
+	for _, entry := range entries {
+		detail := entry.Error
+		if detail == "" {
+			detail = entry.Message
+		}
+		if detail == "" {
+			detail = entry.Reason
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time.Local().Format("2006-01-02 15:04:05"),
+			entry.Host, entry.Event, entry.Result, entry.SentIP, entry.IP, detail)
+	}
+	return tw.Flush()
+}
+
+// historyOpt holds the `dynip history` filters and output format.
+type historyOpt struct {
+	hosts   string
+	since   string
+	until   string
+	results string
+	output  string
+}
+
+func addHistoryFlags(fs *flag.FlagSet, opt *historyOpt) {
+	fs.StringVar(&opt.hosts, "host", "", "comma separated host section names or hostnames")
+	fs.StringVar(&opt.since, "since", "", "entries at or after a date, time or duration ago, e.g. 2024-03-01 or \"30 days\"")
+	fs.StringVar(&opt.until, "until", "", "entries before a date, time or duration ago")
+	fs.StringVar(&opt.results, "result", "", "comma separated results, e.g. SUCCESS,TOO_SOON")
+	fs.StringVar(&opt.output, "o", outputText, "output format: text, csv or json")
+}
+
+// cmdHistory runs `dynip history`, listing the journal entries matching
+// the filters.
+func cmdHistory(o *cliOpts, opt *historyOpt, result *appResult) {
+	hosts, since, until, results, output := opt.hosts, opt.since, opt.until, opt.results, opt.output
+	fail := func(err error) {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+	}
+	usage := func(err error) {
+		result.exitCode = exitUsage
+		result.exitMsg = fmt.Sprintf("%v", err)
+	}
+	if output != outputText && output != outputCSV && output != outputJSON {
+		usage(fmt.Errorf("output format must be %s, %s or %s", outputText, outputCSV, outputJSON))
+		return
+	}
+	appConfig, err := o.loadConfig()
+	if err != nil {
+		fail(err)
+		return
+	}
+	path := appConfig.historyPath()
+	if path == "" {
+		fail(fmt.Errorf("history is not enabled; set %s to YES or a file", keyHistory.name))
+		return
+	}
+
+	hf := &historyFilter{}
+	now := time.Now()
+	if since != "" {
+		if hf.since, err = parseHistoryTime(since, now); err != nil {
+			usage(fmt.Errorf("since: %v", err))
+			return
+		}
+	}
+	if until != "" {
+		if hf.until, err = parseHistoryTime(until, now); err != nil {
+			usage(fmt.Errorf("until: %v", err))
+			return
+		}
+	}
+	if hf.results, err = parseResults(results); err != nil {
+		usage(err)
+		return
+	}
+	if hosts != "" {
+		hf.hosts = make(map[string]bool)
+		for _, name := range strings.Split(hosts, ",") {
+			name = strings.TrimSpace(name)
+			// a host no longer in the config is matched by hostname
+			if sel, err := selectHosts(appConfig, name); err == nil {
+				name = sel[0].getKeyVal(keyHostname)
+			}
+			hf.hosts[strings.ToLower(name)] = true
+		}
+	}
+
+	entries, err := readHistory(path)
+	if err != nil {
+		fail(err)
+		return
+	}
+	var matched []*historyEntry
+	for _, entry := range entries {
+		if hf.match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if err := writeHistory(os.Stdout, matched, output); err != nil {
+		fail(err)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/cfg"
+	"github.com/wiggin77/dynip/pkg/dynip"
+	"github.com/wiggin77/dynip/pkg/dynip/dyniptest"
+)
+
+func makeTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func Test_appendHistory(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.conf.history")
+
+	now := time.Now()
+	for i, res := range []dynip.Result{dynip.SUCCESS, dynip.NOCHANGE, dynip.TOOSOON} {
+		entry := &historyEntry{Time: now.Add(time.Duration(i) * time.Second), Host: "test.example.com",
+			Event: historyUpdate, Result: res}
+		if err := appendHistory(path, entry, 1024*1024, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Result != dynip.SUCCESS || entries[2].Result != dynip.TOOSOON {
+		t.Errorf("entries = %+v, want SUCCESS, NO_CHANGE, TOO_SOON", entries)
+	}
+
+	if entries, err := readHistory(filepath.Join(dir, "missing")); err != nil || len(entries) != 0 {
+		t.Errorf("readHistory(missing) = %v, %v; want no entries", entries, err)
+	}
+}
+
+func Test_compactHistory(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.conf.history")
+	now := time.Now()
+
+	t.Run("age", func(t *testing.T) {
+		_ = os.Remove(path)
+		old := &historyEntry{Time: now.Add(-time.Hour * 48), Host: "old.example.com", Event: historyUpdate}
+		if err := appendHistory(path, old, 1024*1024, time.Hour*72); err != nil {
+			t.Fatal(err)
+		}
+		entry := &historyEntry{Time: now, Host: "new.example.com", Event: historyUpdate}
+		if err := appendHistory(path, entry, 1024*1024, time.Hour*24); err != nil {
+			t.Fatal(err)
+		}
+		entries, _ := readHistory(path)
+		if len(entries) != 1 || entries[0].Host != "new.example.com" {
+			t.Errorf("entries = %+v, want only new.example.com", entries)
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		_ = os.Remove(path)
+		const maxSize = 1000
+		for i := 0; i < 50; i++ {
+			entry := &historyEntry{Time: now.Add(time.Duration(i) * time.Second), Host: "test.example.com",
+				Event: historyUpdate, Result: dynip.SUCCESS}
+			if err := appendHistory(path, entry, maxSize, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() > maxSize+200 {
+			t.Errorf("size = %d, want about %d or less", fi.Size(), maxSize)
+		}
+		entries, _ := readHistory(path)
+		if len(entries) == 0 || !entries[len(entries)-1].Time.Equal(now.Add(time.Second*49)) {
+			t.Errorf("newest entry missing after compaction")
+		}
+	})
+
+	t.Run("unreadable", func(t *testing.T) {
+		if err := ioutil.WriteFile(path, []byte("not json\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		entry := &historyEntry{Time: now, Host: "test.example.com", Event: historyUpdate}
+		if err := appendHistory(path, entry, 1024*1024, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadFile(path)
+		if strings.Contains(string(b), "not json") {
+			t.Errorf("unreadable line not compacted:\n%s", b)
+		}
+	})
+}
+
+func Test_parseSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{s: "10 MB", want: 10 * 1024 * 1024},
+		{s: "512KB", want: 512 * 1024},
+		{s: "1gb", want: 1024 * 1024 * 1024},
+		{s: "2048", want: 2048},
+		{s: " 100 B ", want: 100},
+		{s: "0", wantErr: true},
+		{s: "10 TB", wantErr: true},
+		{s: "MB", wantErr: true},
+		{s: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func Test_parseHistoryTime(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{s: "2024-03-01", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)},
+		{s: "2024-03-01 08:30", want: time.Date(2024, 3, 1, 8, 30, 0, 0, time.Local)},
+		{s: "2024-03-01T08:30", want: time.Date(2024, 3, 1, 8, 30, 0, 0, time.Local)},
+		{s: "2024-03-01T08:30:00Z", want: time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)},
+		{s: "2 days", want: now.Add(-time.Hour * 48)},
+		{s: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseHistoryTime(tt.s, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseHistoryTime(%q) = %v, %v; want %v, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func Test_historyFilter(t *testing.T) {
+	now := time.Now()
+	entries := []*historyEntry{
+		{Time: now.Add(-time.Hour * 3), Host: "office.example.com", Result: dynip.SUCCESS},
+		{Time: now.Add(-time.Hour * 2), Host: "home.example.com", Result: dynip.TOOSOON},
+		{Time: now.Add(-time.Hour), Host: "Office.example.com", Result: dynip.NOCHANGE},
+	}
+	results, err := parseResults("success, no_change")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseResults("SUCCESS,BOGUS"); err == nil {
+		t.Error("parseResults accepted an unknown result")
+	}
+
+	tests := []struct {
+		name string
+		hf   historyFilter
+		want int
+	}{
+		{name: "all", want: 3},
+		{name: "host", hf: historyFilter{hosts: map[string]bool{"office.example.com": true}}, want: 2},
+		{name: "since", hf: historyFilter{since: now.Add(-time.Hour * 2)}, want: 2},
+		{name: "until", hf: historyFilter{until: now.Add(-time.Hour * 2)}, want: 1},
+		{name: "result", hf: historyFilter{results: results}, want: 2},
+		{name: "host and result", hf: historyFilter{hosts: map[string]bool{"home.example.com": true}, results: results}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := 0
+			for _, entry := range entries {
+				if tt.hf.match(entry) {
+					got++
+				}
+			}
+			if got != tt.want {
+				t.Errorf("matched %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeHistory(t *testing.T) {
+	entries := []*historyEntry{{
+		Time: time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC), Host: "test.example.com", Event: historyUpdate,
+		SentIP: "203.0.113.5", Result: dynip.SUCCESS, ServerCode: "OK",
+		Message: "test.example.com updated to 203.0.113.5, again", IP: "203.0.113.5",
+	}}
+
+	var buf bytes.Buffer
+	if err := writeHistory(&buf, entries, outputCSV); err != nil {
+		t.Fatal(err)
+	}
+	want := "time,host,event,detected_ip,sent_ip,decision,reason,result,server_code,message,ip,error\n" +
+		`2024-03-01T08:30:00Z,test.example.com,update,,203.0.113.5,,,SUCCESS,OK,"test.example.com updated to 203.0.113.5, again",203.0.113.5,` + "\n"
+	if buf.String() != want {
+		t.Errorf("csv:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writeHistory(&buf, nil, outputJSON); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("json with no entries = %s, want []", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeHistory(&buf, entries, outputText); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "updated to 203.0.113.5, again") {
+		t.Errorf("text output missing message:\n%s", buf.String())
+	}
+}
+
+func Test_sendUpdateHistory(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	fake := dyniptest.NewServer()
+	fake.AddAccount("testuser", "testtoken")
+	fake.AddHost("testuser", "test.example.com", "")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	appConfig, err := makeTestConfig(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appConfig.PrependSource(cfg.NewSrcMapFromMap(map[string]string{"myip": "203.0.113.5", "history": path}))
+	tlog := logrus.New()
+	tlog.Out = ioutil.Discard
+
+	if _, err := sendUpdate(context.Background(), appConfig, tlog); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sendOffline(context.Background(), appConfig, tlog); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.Event != historyUpdate || e.Host != "test.example.com" || e.Result != dynip.SUCCESS ||
+		e.SentIP != "203.0.113.5" || e.IP != "203.0.113.5" || e.ServerCode != "OK" {
+		t.Errorf("update entry = %+v", e)
+	}
+	if e := entries[1]; e.Event != historyOffline || !e.Result.Success() {
+		t.Errorf("offline entry = %+v", e)
+	}
+}
+
+func Test_historyPath(t *testing.T) {
+	tests := []struct {
+		name string
+		val  string
+		want string
+	}{
+		{name: "default", val: "", want: ""},
+		{name: "enabled", val: "YES", want: "/etc/dynip.conf.history"},
+		{name: "disabled", val: "NO", want: ""},
+		{name: "relative", val: "dynip.history", want: "/etc/dynip.history"},
+		{name: "absolute", val: "/var/lib/dynip/history", want: "/var/lib/dynip/history"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig, err := NewAppConfigFromMap(map[string]string{
+				"hostname": "test.example.com",
+				"username": "testuser",
+				"token":    "testtoken",
+				"history":  tt.val,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			appConfig.history = historyFile("/etc/dynip.conf")
+			if got := appConfig.historyPath(); got != filepath.FromSlash(tt.want) && got != tt.want {
+				t.Errorf("historyPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lockHistory(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.conf.history")
+
+	unlock, err := lockHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan func())
+	go func() {
+		unlock2, err := lockHistory(path)
+		if err != nil {
+			t.Error(err)
+			unlock2 = func() {}
+		}
+		locked <- unlock2
+	}()
+	select {
+	case <-locked:
+		t.Error("second lock taken while the first is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case unlock2 := <-locked:
+		unlock2()
+	case <-time.After(5 * time.Second):
+		t.Error("second lock not taken after the first was released")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package main
+
+import "os"
+
+// lockFile does nothing on platforms without file locks; only writes
+// within the process are serialized.
+func lockFile(f *os.File) error {
+	return nil
+}
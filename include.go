@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wiggin77/cfg"
+	"github.com/wiggin77/cfg/ini"
+)
+
+// srcInclude is a config Source that merges all files matching one or
+// more glob patterns. Files are merged in pattern order and, within each
+// pattern, sorted by name, so later files override earlier ones. The
+// patterns are matched again whenever the source is checked for changes,
+// so added and removed files are picked up.
+type srcInclude struct {
+	cfg.AbstractSourceMonitor
+	mutex    sync.Mutex
+	patterns []string
+	files    []string // files merged by the last load
+	props    map[string]string
+	lm       time.Time
+}
+
+// newSrcInclude creates a Source for the include patterns and loads all
+// matching files, returning an error naming the first file that fails.
+func newSrcInclude(patterns []string) (*srcInclude, error) {
+	src := &srcInclude{patterns: patterns}
+	src.SetMonitorFreq(time.Minute)
+	if err := src.load(); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// includePatterns splits the value of the include key into glob patterns.
+// Patterns are separated by commas, and relative patterns are relative to
+// the directory of the config file containing them.
+func includePatterns(file string, val string) []string {
+	var patterns []string
+	for _, p := range strings.Split(val, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(file), p)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// includeFiles returns the files matching the patterns in merge order.
+func includeFiles(patterns []string) ([]string, error) {
+	var files []string
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %v", p, err)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && !fi.IsDir() {
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+// loadIncludeFile returns the properties of an included file, which may
+// be in any supported format.
+func loadIncludeFile(file string) (map[string]string, error) {
+	format, err := configFormat(file, formatAuto)
+	if err != nil {
+		return nil, err
+	}
+	if format != formatConf {
+		return loadStructFile(file, format)
+	}
+	var in ini.Ini
+	if err := in.LoadFromFilespec(file); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return in.ToMap(), nil
+}
+
+// load matches the patterns and merges all the files.
+func (src *srcInclude) load() error {
+	files, err := includeFiles(src.patterns)
+	if err != nil {
+		return err
+	}
+	props := make(map[string]string)
+	var lm time.Time
+	for _, file := range files {
+		m, err := loadIncludeFile(file)
+		if err != nil {
+			return fmt.Errorf("include: %v", err)
+		}
+		if _, ok := m[keyInclude.name]; ok {
+			return fmt.Errorf("include: %s: included files cannot include other files", file)
+		}
+		for k, v := range m {
+			props[k] = v
+		}
+		if fi, err := os.Stat(file); err == nil && fi.ModTime().After(lm) {
+			lm = fi.ModTime()
+		}
+	}
+
+	src.mutex.Lock()
+	src.files = files
+	src.props = props
+	src.lm = lm
+	src.mutex.Unlock()
+	return nil
+}
+
+// GetProps returns the merged properties of all included files, reloading
+// them if any file was added, removed or modified.
+func (src *srcInclude) GetProps() (map[string]string, error) {
+	src.mutex.Lock()
+	last := src.lm
+	src.mutex.Unlock()
+
+	lm, err := src.GetLastModified()
+	if err != nil {
+		return nil, err
+	}
+	if !lm.Equal(last) {
+		if err := src.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+	return src.props, nil
+}
+
+// GetLastModified returns the latest modification time of the included
+// files, or the current time if the set of matching files has changed.
+func (src *srcInclude) GetLastModified() (time.Time, error) {
+	files, err := includeFiles(src.patterns)
+	if err != nil {
+		return time.Now(), err
+	}
+
+	src.mutex.Lock()
+	prev := src.files
+	src.mutex.Unlock()
+	if strings.Join(files, "\n") != strings.Join(prev, "\n") {
+		return time.Now(), nil
+	}
+
+	var lm time.Time
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return time.Now(), err
+		}
+		if fi.ModTime().After(lm) {
+			lm = fi.ModTime()
+		}
+	}
+	return lm, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, file string, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_include(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	confd := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(confd, 0700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "dynip.conf")
+	writeTestFile(t, file, "username = testuser\ntoken = testtoken\nproto = http\ninclude = conf.d/*.conf\n")
+	writeTestFile(t, filepath.Join(confd, "10-office.conf"), "[office]\nhostname = office.example.com\nproto = https\n")
+	writeTestFile(t, filepath.Join(confd, "20-home.conf"), "[home]\nhostname = home.example.com\n")
+	writeTestFile(t, filepath.Join(confd, "30-override.conf"), "[office]\nproto = http\nwildcard = ON\n")
+
+	appConfig, err := NewAppConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := appConfig.hostNames(), []string{"home", "office"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("hostNames() = %v, want %v", got, want)
+	}
+
+	office := appConfig.host("office")
+	if got := office.getKeyVal(keyHostname); got != "office.example.com" {
+		t.Errorf("office hostname = %s, want office.example.com", got)
+	}
+	if got := office.getKeyVal(keyProto); got != "http" {
+		t.Errorf("office proto = %s, want http from the later file", got)
+	}
+	if got := office.getKeyVal(keyWildcard); got != "ON" {
+		t.Errorf("office wildcard = %s, want ON", got)
+	}
+	home := appConfig.host("home")
+	if got := home.getKeyVal(keyUsername); got != "testuser" {
+		t.Errorf("home username = %s, want inherited testuser", got)
+	}
+	if got := home.getKeyVal(keyWildcard); got != "OFF" {
+		t.Errorf("home wildcard = %s, want default OFF", got)
+	}
+
+	probs, err := checkConfigFile(file, formatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(probs) != 0 {
+		t.Errorf("checkConfigFile() = %v, want no problems", probs)
+	}
+}
+
+func Test_srcIncludeReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.conf")
+	b := filepath.Join(dir, "b.conf")
+	writeTestFile(t, a, "[a]\nhostname = a.example.com\n")
+
+	src, err := newSrcInclude([]string{filepath.Join(dir, "*.conf")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// added file
+	writeTestFile(t, b, "[b]\nhostname = b.example.com\n")
+	props, err := src.GetProps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props["b.hostname"] != "b.example.com" {
+		t.Errorf("added file not loaded: %v", props)
+	}
+
+	// modified file
+	writeTestFile(t, a, "[a]\nhostname = a2.example.com\n")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(a, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if props, err = src.GetProps(); err != nil {
+		t.Fatal(err)
+	}
+	if props["a.hostname"] != "a2.example.com" {
+		t.Errorf("modified file not reloaded: %v", props)
+	}
+
+	// removed file
+	if err := os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	if props, err = src.GetProps(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := props["b.hostname"]; ok {
+		t.Errorf("removed file still loaded: %v", props)
+	}
+}
+
+func Test_includeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "dynip.conf")
+	writeTestFile(t, file, "username = u\ntoken = t\nhostname = h.example.com\ninclude = *.yaml\n")
+	bad := filepath.Join(dir, "bad.yaml")
+	writeTestFile(t, bad, "hostname: [unclosed\n")
+
+	if _, err := NewAppConfig(file); err == nil || !strings.Contains(err.Error(), bad) {
+		t.Errorf("NewAppConfig() error = %v, want error naming %s", err, bad)
+	}
+	probs, err := checkConfigFile(file, formatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(probs) != 1 || probs[0].file != bad {
+		t.Errorf("checkConfigFile() = %v, want one problem in %s", probs, bad)
+	}
+
+	writeTestFile(t, bad, "include: other/*.conf\n")
+	if _, err := NewAppConfig(file); err == nil || !strings.Contains(err.Error(), "cannot include") {
+		t.Errorf("NewAppConfig() error = %v, want nested include error", err)
+	}
+}
+
+func Test_hostsList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "dynip.toml")
+	writeTestFile(t, file, `username = "u"
+token = "t"
+
+[[hosts]]
+name = "office"
+hostname = "office.example.com"
+
+[[hosts]]
+name = "home"
+hostname = "home.example.com"
+wildcard = true
+`)
+	appConfig, err := NewAppConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := appConfig.hosts()
+	if len(hosts) != 2 {
+		t.Fatalf("hosts() returned %d hosts, want 2", len(hosts))
+	}
+	if got := hosts[0].getKeyVal(keyHostname); got != "home.example.com" {
+		t.Errorf("hosts()[0] hostname = %s, want home.example.com", got)
+	}
+	if got := hosts[0].getKeyVal(keyWildcard); got != "ON" {
+		t.Errorf("home wildcard = %s, want ON", got)
+	}
+	if got := hosts[1].getKeyVal(keyWildcard); got != "OFF" {
+		t.Errorf("office wildcard = %s, want OFF", got)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/dynip/pkg/dynip"
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/term"
+)
+
+// initProviders lists the providers supported by `dynip init` and the
+// API URL of each.
+var initProviders = map[string]string{
+	providerName: keyURL.def,
+}
+
+// initAnswers holds the values collected by the init wizard.
+type initAnswers struct {
+	Provider        string
+	URL             string
+	Username        string
+	Token           string
+	Hostname        string
+	Tld             string
+	Detect          string
+	DetectURL       string
+	DetectInterface string
+	Interval        string
+}
+
+// cmdInit runs `dynip init`, which asks for the essential settings and
+// writes a commented config file.
+func cmdInit(fileConfig string, force bool, result *appResult) {
+	if err := runInit(os.Stdin, os.Stdout, fileConfig, force, true); err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	result.exitMsg = fmt.Sprintf("wrote %s", fileConfig)
+}
+
+// runInit runs the wizard, reading answers from in and writing prompts to
+// out, then writes the config file. The credentials test is only offered
+// when allowTest is true.
+func runInit(in io.Reader, out io.Writer, file string, force bool, allowTest bool) error {
+	if _, err := os.Stat(file); err == nil && !force {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", file)
+	}
+
+	p := &prompter{in: bufio.NewReader(in), out: out}
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		p.readSecret = func() (string, error) {
+			b, err := term.ReadPassword(int(f.Fd()))
+			fmt.Fprintln(out)
+			return string(b), err
+		}
+	}
+	fmt.Fprintf(out, "This will create %s. Press enter to accept the [default].\n\n", file)
+
+	ans, err := askInit(p)
+	if err != nil {
+		return err
+	}
+
+	if allowTest {
+		if ip, skipped := credentialTestIP(ans); skipped != "" {
+			fmt.Fprintln(out, skipped)
+		} else {
+			fmt.Fprintf(out, "The provider has no read-only check, so testing the credentials sends a real update\n"+
+				"of %s to %s, its current address, with only the hostname and address.\n", ans.Hostname, ip)
+			test, err := p.askBool("Send the test update?", false)
+			if err != nil {
+				return err
+			}
+			if test {
+				fmt.Fprintln(out, testCredentials(ans, ip))
+			}
+		}
+	}
+
+	if err := writeInitConfig(file, ans); err != nil {
+		return err
+	}
+
+	// the answers were validated, but report anything the checker finds
+	probs, err := checkConfigFile(file, formatConf)
+	if err != nil {
+		return err
+	}
+	for _, prob := range probs {
+		fmt.Fprintln(out, prob)
+	}
+	return nil
+}
+
+// askInit asks all the wizard questions.
+func askInit(p *prompter) (*initAnswers, error) {
+	ans := &initAnswers{}
+	var err error
+
+	names := make([]string, 0, len(initProviders))
+	for name := range initProviders {
+		names = append(names, name)
+	}
+	if ans.Provider, err = p.askChoice("Provider", names, providerName); err != nil {
+		return nil, err
+	}
+	ans.URL = initProviders[ans.Provider]
+
+	if ans.Username, err = p.ask("Username", "", nil); err != nil {
+		return nil, err
+	}
+	if ans.Token, err = p.askSecret("Token"); err != nil {
+		return nil, err
+	}
+	if ans.Hostname, err = p.ask("Hostname to update", "", checkInitHostname); err != nil {
+		return nil, err
+	}
+	tld, err := deriveTld(ans.Hostname)
+	if err != nil {
+		return nil, err
+	}
+	validTld := func(s string) error {
+		if s == "" {
+			return nil
+		}
+		if err := checkHost(s); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(strings.ToLower(ans.Hostname), "."+strings.ToLower(s)) {
+			return fmt.Errorf("hostname %s is not within %s", ans.Hostname, s)
+		}
+		return nil
+	}
+	if ans.Tld, err = p.ask("Root domain (tld), blank for domains like example.com", tld, validTld); err != nil {
+		return nil, err
+	}
+
+	detects := []string{detectServer, detectURL, detectInterface}
+	if ans.Detect, err = p.askChoice("Detect the IP address by (server = let the provider see it)", detects, detectServer); err != nil {
+		return nil, err
+	}
+	switch ans.Detect {
+	case detectURL:
+		valid := func(s string) error { return checkValue(TYPEURL, s) }
+		if ans.DetectURL, err = p.ask("URL returning your public IP", "https://api.ipify.org", valid); err != nil {
+			return nil, err
+		}
+	case detectInterface:
+		valid := func(s string) error {
+			_, err := net.InterfaceByName(s)
+			return err
+		}
+		if ans.DetectInterface, err = p.ask("Network interface", "", valid); err != nil {
+			return nil, err
+		}
+	}
+
+	valid := func(s string) error { return checkValue(TYPEDURATION, s) }
+	if ans.Interval, err = p.ask("Update interval", keyInterval.def, valid); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// checkInitHostname returns an error unless s is a hostname below a
+// public suffix.
+func checkInitHostname(s string) error {
+	if err := checkHost(s); err != nil {
+		return err
+	}
+	_, err := deriveTld(s)
+	return err
+}
+
+// deriveTld returns the tld to configure for hostname using the public
+// suffix list. The provider only needs it when the suffix has more than
+// one label, such as co.uk; otherwise an empty string is returned.
+func deriveTld(hostname string) (string, error) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if _, err := publicsuffix.EffectiveTLDPlusOne(hostname); err != nil {
+		return "", err
+	}
+	suffix, _ := publicsuffix.PublicSuffix(hostname)
+	if !strings.Contains(suffix, ".") {
+		return "", nil
+	}
+	return suffix, nil
+}
+
+// credentialTestIP returns the address the hostname resolves to, for a
+// credentials test, or why the test is skipped. A test is only possible
+// when the hostname has exactly one IPv4 address; with several addresses,
+// or an IPv6 one, the update would replace them.
+func credentialTestIP(ans *initAnswers) (string, string) {
+	addrs, err := lookupHost(context.Background(), ans.Hostname)
+	if err != nil || len(addrs) == 0 {
+		return "", fmt.Sprintf("Skipped the credentials test: %s does not resolve, so a test would change the record.", ans.Hostname)
+	}
+	if len(addrs) != 1 || net.ParseIP(addrs[0]).To4() == nil {
+		return "", fmt.Sprintf("Skipped the credentials test: %s has %s, so a test would change the record.",
+			ans.Hostname, strings.Join(addrs, ", "))
+	}
+	return addrs[0], ""
+}
+
+// credentialTestConfig returns the config for a credentials test, which
+// sends only the hostname and address: no tld, mx, backmx or wildcard.
+func credentialTestConfig(ans *initAnswers) (*AppConfig, error) {
+	return NewAppConfigFromMap(map[string]string{
+		keyURL.name:      ans.URL,
+		keyUsername.name: ans.Username,
+		keyToken.name:    ans.Token,
+		keyHostname.name: ans.Hostname,
+	})
+}
+
+// testCredentials sends an update of the hostname to ip, its current
+// address, and describes the result.
+func testCredentials(ans *initAnswers, ip string) string {
+	appConfig, err := credentialTestConfig(ans)
+	if err != nil {
+		return fmt.Sprintf("Skipped the test: %v", err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	reply, err := sendRequest(context.Background(), appConfig, logrus.NewEntry(logger), ip, ans.Token)
+	switch {
+	case reply.Result == dynip.NOAUTH:
+		return "Credentials were rejected (NO_AUTH); check the username and token."
+	case reply.Result == dynip.NOSERVICE:
+		return fmt.Sprintf("Credentials were accepted but dynamic DNS is not enabled for %s (NO_SERVICE).", ans.Hostname)
+	case reply.Result == dynip.SUCCESS || reply.Result == dynip.NOCHANGE || reply.Result == dynip.TOOSOON:
+		return fmt.Sprintf("Credentials accepted (%s).", reply.Result)
+	case reply.Result == dynip.LOCALERROR:
+		return fmt.Sprintf("Could not reach the provider: %v", err)
+	case reply.Result == dynip.PROXYERROR:
+		return fmt.Sprintf("Could not reach the provider through the proxy: %v", err)
+	}
+	return fmt.Sprintf("The provider responded %s; the credentials could not be confirmed.", reply.Result)
+}
+
+// writeInitConfig writes the config file, readable only by its owner since
+// it contains the token.
+func writeInitConfig(file string, ans *initAnswers) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// O_CREATE does not change the mode of an existing file
+	if err := f.Chmod(0600); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := initTemplate.Execute(f, ans); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var initTemplate = template.Must(template.New("init").Parse(`# dynip config file written by 'dynip init'.
+# See https://github.com/wiggin77/dynip/blob/master/dynip.conf for all settings.
+# Check changes with 'dynip config check'.
+
+# Provider: {{.Provider}}
+url = {{.URL}}
+
+# Account username and dynamic DNS token. This file contains the token, so keep
+# it readable only by the account running dynip, or move the token to a file
+# named by token_file.
+username = {{.Username}}
+token = {{.Token}}
+
+# The full hostname being updated.
+hostname = {{.Hostname}}
+
+# The root domain of the hostname when it is below a suffix such as co.uk;
+# blank for domains like example.com.
+tld = {{.Tld}}
+
+# The provider detects the address when myip is 1.1.1.1 and detect = server.
+myip = 1.1.1.1
+
+# How the IP address is found: server, url or interface.
+detect = {{.Detect}}
+{{- if .DetectURL}}
+detect_url = {{.DetectURL}}
+{{- end}}
+{{- if .DetectInterface}}
+detect_interface = {{.DetectInterface}}
+{{- end}}
+
+# Update interval when running as a daemon. Anything less than 10 minutes will
+# likely cause TOO_SOON errors.
+interval = {{.Interval}}
+`))
+
+// prompter asks questions on a terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// readSecret reads a line without echo; nil if in is not a terminal
+	readSecret func() (string, error)
+}
+
+// ask prompts until a valid answer is given. An empty answer selects def.
+// If valid is nil any non-empty answer is accepted.
+func (p *prompter) ask(question string, def string, valid func(string) error) (string, error) {
+	return p.prompt(question, def, valid, false)
+}
+
+// askSecret prompts for a required answer, without echoing it on a
+// terminal.
+func (p *prompter) askSecret(question string) (string, error) {
+	return p.prompt(question, "", nil, true)
+}
+
+func (p *prompter) prompt(question string, def string, valid func(string) error, secret bool) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+		var line string
+		var err error
+		if secret && p.readSecret != nil {
+			line, err = p.readSecret()
+		} else {
+			line, err = p.in.ReadString('\n')
+		}
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("init cancelled: %v", err)
+		}
+		ans := strings.TrimSpace(line)
+		if ans == "" {
+			ans = def
+		}
+		if ans == "" && valid == nil {
+			fmt.Fprintln(p.out, "  an answer is required")
+			continue
+		}
+		if valid != nil {
+			if err := valid(ans); err != nil {
+				fmt.Fprintf(p.out, "  %v\n", err)
+				continue
+			}
+		}
+		return ans, nil
+	}
+}
+
+// askChoice prompts until one of choices is given.
+func (p *prompter) askChoice(question string, choices []string, def string) (string, error) {
+	valid := func(s string) error {
+		for _, c := range choices {
+			if s == c {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(choices, ", "))
+	}
+	ans, err := p.ask(fmt.Sprintf("%s (%s)", question, strings.Join(choices, ", ")), def, func(s string) error {
+		return valid(strings.ToLower(s))
+	})
+	return strings.ToLower(ans), err
+}
+
+// askBool prompts for a yes or no answer.
+func (p *prompter) askBool(question string, def bool) (bool, error) {
+	d := "no"
+	if def {
+		d = "yes"
+	}
+	ans, err := p.ask(question+" (yes, no)", d, func(s string) error {
+		if !isTrue(s) && !isFalse(s) && !strings.EqualFold(s, "y") && !strings.EqualFold(s, "n") {
+			return fmt.Errorf("answer yes or no")
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return isTrue(ans) || strings.EqualFold(ans, "y"), nil
+}
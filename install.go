@@ -3,28 +3,130 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/kardianos/service"
 )
 
+const (
+	defaultServiceName        = "dynip"
+	defaultServiceDescription = "Dynamic IP update service"
+)
+
+// srvOpt holds the service options from the command line. Each named
+// instance is a separate service, normally with its own config file.
 type srvOpt struct {
-	install bool
-	config  string
-	user    string
-	pw      string
+	name        string
+	description string
+	config      string
+	format      string
+	user        string
+	pw          string
+	args        stringList // extra arguments for the service command line
+	env         stringList // KEY=VALUE environment variables for the service
+	dir         string     // working directory
+	depends     stringList // services that must start first
+}
+
+// addServiceFlags adds the flags for installing services. The defaults
+// are the current values.
+func addServiceFlags(fs *flag.FlagSet, opt *srvOpt) {
+	fs.StringVar(&opt.name, "name", opt.name, "service name, to install or control more than one instance")
+	fs.StringVar(&opt.description, "description", opt.description, "service description")
+	fs.StringVar(&opt.user, "user", opt.user, "user account name to run service")
+	fs.StringVar(&opt.pw, "pw", opt.pw, "password of user account to run service")
+	fs.Var(&opt.args, "arg", "extra argument for the service command line; may be repeated")
+	fs.Var(&opt.env, "env", "KEY=VALUE environment variable for the service; may be repeated")
+	fs.StringVar(&opt.dir, "dir", opt.dir, "working directory for the service")
+	fs.Var(&opt.depends, "depends", "service that must start before this one; may be repeated")
+}
+
+// splitEnv splits an -env value into key and value.
+func splitEnv(kv string) (string, string, error) {
+	i := strings.Index(kv, "=")
+	if i < 1 {
+		return "", "", fmt.Errorf("-env '%s' must be KEY=VALUE", kv)
+	}
+	return kv[:i], kv[i+1:], nil
+}
+
+// systemdEnvDir holds the environment files of systemd services, next to
+// their units.
+var systemdEnvDir = "/etc/systemd/system"
+
+// serviceEnvFile returns the environment file for a systemd service. It
+// depends only on the name so uninstall can remove it.
+func serviceEnvFile(opt *srvOpt) string {
+	return filepath.Join(systemdEnvDir, serviceConfig(opt).Name+".env")
+}
+
+// writeEnvFile writes the -env variables as a systemd EnvironmentFile,
+// readable only by root since values may be secrets.
+func writeEnvFile(path string, env []string) error {
+	var sb strings.Builder
+	for _, kv := range env {
+		k, v, err := splitEnv(kv)
+		if err != nil {
+			return err
+		}
+		if strings.ContainsAny(kv, "\r\n") {
+			return fmt.Errorf("-env '%s' must not contain a line break", k)
+		}
+		fmt.Fprintf(&sb, "%s=\"%s\"\n", k, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v))
+	}
+	if err := ioutil.WriteFile(path, []byte(sb.String()), 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
+
+// setServiceEnv sets the -env environment variables in this process, as
+// given on the service command line.
+func setServiceEnv(env []string) error {
+	for _, kv := range env {
+		k, v, err := splitEnv(kv)
+		if err != nil {
+			return err
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func serviceInstall() error {
+func serviceInstall(opt *srvOpt) error {
 	var err error
-	opt, err := parseCmdLine()
-	if err != nil {
+	for _, kv := range opt.env {
+		if _, _, err = splitEnv(kv); err != nil {
+			return err
+		}
+	}
+	// the service may run from another directory
+	if opt.config, err = filepath.Abs(opt.config); err != nil {
 		return err
 	}
 
-	cfg := serviceConfig()
-	cfg.Arguments = serviceCmdLineArgs(opt)
+	// systemd reads the environment from a file only root can read, rather
+	// than the command line where anyone can see it
+	envFile := ""
+	if len(opt.env) > 0 && service.Platform() == "linux-systemd" {
+		envFile = serviceEnvFile(opt)
+		if err = writeEnvFile(envFile, opt.env); err != nil {
+			return err
+		}
+	}
+
+	cfg := serviceConfig(opt)
+	cfg.Arguments = serviceCmdLineArgs(opt, envFile == "")
 	cfg.UserName = opt.user
+	cfg.WorkingDirectory = opt.dir
+	cfg.Dependencies = opt.depends
+	cfg.Option["SystemdScript"] = systemdInstallUnit(opt, envFile)
 	if opt.pw != "" {
 		cfg.Option["Password"] = opt.pw
 	}
@@ -40,19 +142,27 @@ func serviceInstall() error {
 	return nil
 }
 
-func serviceUninstall() error {
-	cfg := serviceConfig()
+func serviceUninstall(opt *srvOpt) error {
+	cfg := serviceConfig(opt)
 	prg := &program{}
 	srv, err := service.New(prg, cfg)
 	if err != nil {
 		return err
 	}
-	return srv.Uninstall()
+	if err := srv.Uninstall(); err != nil {
+		return err
+	}
+	if service.Platform() == "linux-systemd" {
+		if err := os.Remove(serviceEnvFile(opt)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
 }
 
-func serviceRun() error {
-	cfg := serviceConfig()
-	prg := &program{}
+func serviceRun(o *cliOpts) error {
+	cfg := serviceConfig(o.service())
+	prg := &program{opts: o}
 	srv, err := service.New(prg, cfg)
 	if err != nil {
 		return err
@@ -60,32 +170,75 @@ func serviceRun() error {
 	return srv.Run() // blocks until Stop()
 }
 
-func serviceConfig() *service.Config {
+// serviceControl starts, stops or restarts the installed service.
+func serviceControl(opt *srvOpt, action string) error {
+	srv, err := service.New(&program{}, serviceConfig(opt))
+	if err != nil {
+		return err
+	}
+	return service.Control(srv, action)
+}
+
+// serviceStatus returns the status of the installed service.
+func serviceStatus(opt *srvOpt) (service.Status, error) {
+	srv, err := service.New(&program{}, serviceConfig(opt))
+	if err != nil {
+		return service.StatusUnknown, err
+	}
+	return srv.Status()
+}
+
+// systemdInstallUnit returns the systemd unit for the config file. If the
+// config cannot be loaded yet, only its directory is writable.
+func systemdInstallUnit(opt *srvOpt, envFile string) string {
+	appConfig, err := NewAppConfigFormat(opt.config, opt.format)
+	if err != nil {
+		dir := filepath.Dir(opt.config)
+		if abs, err := filepath.Abs(opt.config); err == nil {
+			dir = filepath.Dir(abs)
+		}
+		return systemdUnit(watchdogTimeout, []string{dir}, envFile)
+	}
+	return systemdUnit(watchdogTimeout, writablePaths(appConfig, opt.config), envFile)
+}
+
+func serviceConfig(opt *srvOpt) *service.Config {
 	cfg := &service.Config{
-		Name:        "dynip",
-		DisplayName: "dynip",
-		Description: "Dynamic IP update service",
+		Name:        opt.name,
+		DisplayName: opt.name,
+		Description: opt.description,
 		Option:      make(map[string]interface{}),
 	}
+	if cfg.Name == "" {
+		cfg.Name = defaultServiceName
+		cfg.DisplayName = defaultServiceName
+	}
+	if cfg.Description == "" {
+		cfg.Description = defaultServiceDescription
+	}
 	return cfg
 }
 
-func serviceCmdLineArgs(opt *srvOpt) []string {
-	arr := []string{"-d"}
+// serviceCmdLineArgs returns the service command line, which runs the
+// daemon command. A named instance passes its name so the service manager
+// can find it. Environment variables are passed as -env if withEnv is set,
+// for service managers without an environment file.
+func serviceCmdLineArgs(opt *srvOpt, withEnv bool) []string {
+	arr := []string{"daemon"}
 	if opt.config != "" {
 		arr = append(arr, "-f")
 		arr = append(arr, opt.config)
 	}
-	return arr
-}
-
-func parseCmdLine() (*srvOpt, error) {
-	opt := srvOpt{}
-	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-	fs.BoolVar(&opt.install, "i", false, "install as service/daemon")
-	fs.StringVar(&opt.config, "f", defConfigFile(), "config file")
-	fs.StringVar(&opt.user, "user", "", "user account name to run service")
-	fs.StringVar(&opt.pw, "pw", "", "password of user account to run service")
-	err := fs.Parse(os.Args[1:])
-	return &opt, err
+	if opt.format != formatAuto {
+		arr = append(arr, "-format", opt.format)
+	}
+	if opt.name != "" && opt.name != defaultServiceName {
+		arr = append(arr, "-name", opt.name)
+	}
+	if withEnv {
+		for _, kv := range opt.env {
+			arr = append(arr, "-env", kv)
+		}
+	}
+	return append(arr, opt.args...)
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func Test_serviceCmdLineArgs(t *testing.T) {
+	named := []string{"-f", "/etc/dynip/office.yaml", "-format", "yaml", "-name", "dynip-office",
+		"-env", "VAULT_ADDR=https://vault:8200", "-env", "A=b=c", "-arg", "-v"}
+	tests := []struct {
+		name    string
+		args    []string
+		withEnv bool
+		want    []string
+	}{
+		{name: "defaults", args: []string{"-f", "/etc/dynip.conf"}, want: []string{"daemon", "-f", "/etc/dynip.conf"}},
+		{name: "named instance", args: named, withEnv: true,
+			want: []string{"daemon", "-f", "/etc/dynip/office.yaml", "-format", "yaml", "-name", "dynip-office",
+				"-env", "VAULT_ADDR=https://vault:8200", "-env", "A=b=c", "-v"}},
+		{name: "environment file", args: named,
+			want: []string{"daemon", "-f", "/etc/dynip/office.yaml", "-format", "yaml", "-name", "dynip-office", "-v"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := &srvOpt{}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.StringVar(&opt.config, "f", "", "")
+			fs.StringVar(&opt.format, "format", formatAuto, "")
+			addServiceFlags(fs, opt)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if got := serviceCmdLineArgs(opt, tt.withEnv); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("serviceCmdLineArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serviceConfig(t *testing.T) {
+	cfg := serviceConfig(&srvOpt{name: "dynip-home", description: "Home dynamic IP"})
+	if cfg.Name != "dynip-home" || cfg.DisplayName != "dynip-home" || cfg.Description != "Home dynamic IP" {
+		t.Errorf("serviceConfig() = %+v", cfg)
+	}
+	cfg = serviceConfig(&srvOpt{})
+	if cfg.Name != defaultServiceName || cfg.Description != defaultServiceDescription {
+		t.Errorf("serviceConfig() defaults = %+v", cfg)
+	}
+}
+
+func Test_setServiceEnv(t *testing.T) {
+	defer os.Unsetenv("DYNIP_TEST_ENV")
+	if err := setServiceEnv([]string{"DYNIP_TEST_ENV=a=b"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("DYNIP_TEST_ENV"); got != "a=b" {
+		t.Errorf("DYNIP_TEST_ENV = %q, want a=b", got)
+	}
+	for _, bad := range []string{"NOVALUE", "=value"} {
+		if err := setServiceEnv([]string{bad}); err == nil {
+			t.Errorf("setServiceEnv(%q) accepted", bad)
+		}
+	}
+}
+
+func Test_writeEnvFile(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.env")
+	writeTestFile(t, path, "old\n")
+
+	if err := writeEnvFile(path, []string{"VAULT_TOKEN=s3cret", `A=b "c" \d`}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "VAULT_TOKEN=\"s3cret\"\nA=\"b \\\"c\\\" \\\\d\"\n"; string(b) != want {
+		t.Errorf("env file = %q, want %q", b, want)
+	}
+	if fi, err := os.Stat(path); err != nil || (runtime.GOOS != "windows" && fi.Mode().Perm() != 0600) {
+		t.Errorf("env file mode = %v, %v; want 0600", fi.Mode(), err)
+	}
+	if err := writeEnvFile(path, []string{"A=b\nc"}); err == nil {
+		t.Error("writeEnvFile accepted a line break")
+	}
+}
+
+func Test_systemdUnitDependencies(t *testing.T) {
+	funcs := template.FuncMap{"cmd": func(s string) string { return s }, "cmdEscape": func(s string) string { return s }}
+	tmpl, err := template.New("").Funcs(funcs).Parse(systemdUnit(watchdogTimeout, []string{"/etc/dynip"},
+		"/etc/systemd/system/dynip-office.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	err = tmpl.Execute(&sb, map[string]interface{}{
+		"Name": "dynip-office", "Description": "Office", "Path": "/usr/local/bin/dynip",
+		"Arguments": []string{"-d"}, "Dependencies": []string{"wg-quick@wg0.service"},
+		"WorkingDirectory": "/var/lib/dynip", "UserName": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"After=wg-quick@wg0.service\nRequires=wg-quick@wg0.service\n",
+		"WorkingDirectory=/var/lib/dynip\n", "EnvironmentFile=/etc/systemd/system/dynip-office.env\n"} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("unit missing %q:\n%s", want, sb.String())
+		}
+	}
+}
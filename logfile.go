@@ -0,0 +1,359 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats for log_format.
+const (
+	logFormatText   = "text"
+	logFormatJSON   = "json"
+	logFormatLogfmt = "logfmt"
+)
+
+// logFormatter returns the logrus formatter for a log_format value.
+func logFormatter(format string) logrus.Formatter {
+	switch strings.ToLower(format) {
+	case logFormatJSON:
+		return &logrus.JSONFormatter{TimestampFormat: time.RFC3339}
+	case logFormatLogfmt:
+		return logfmtFormatter{}
+	}
+	return &logrus.TextFormatter{}
+}
+
+// logfmtFormatter writes one line of key=value pairs per entry: time, level
+// and msg, then the fields sorted by key.
+type logfmtFormatter struct{}
+
+// Format implements logrus.Formatter.
+func (logfmtFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	line := fmt.Sprintf("time=%s level=%s msg=%s", entry.Time.Format(time.RFC3339),
+		entry.Level, logfmtValue(entry.Message))
+	if fields := logfmtFields(entry.Data); fields != "" {
+		line += " " + fields
+	}
+	return []byte(line + "\n"), nil
+}
+
+// logfmtFields returns the fields as key=value pairs sorted by key.
+func logfmtFields(data logrus.Fields) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := data[k]
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		pairs = append(pairs, k+"="+logfmtValue(fmt.Sprint(v)))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// logfmtValue quotes a value if it is empty or contains spaces, quotes,
+// equals signs or control characters.
+func logfmtValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '"' || r == '=' || r == 0x7f || r == utf8.RuneError {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// Log file names for logging to the standard streams.
+const (
+	logStdout = "stdout"
+	logStderr = "stderr"
+)
+
+// isStdLog returns true if the log key names a standard stream.
+func isStdLog(file string) bool {
+	return strings.EqualFold(file, logStdout) || strings.EqualFold(file, logStderr)
+}
+
+// logMaxSize returns log_max_size in bytes, or zero for no limit.
+func logMaxSize(config *AppConfig) int64 {
+	size, err := parseSize(config.getKeyVal(keyLogMaxSize))
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// logMaxBackups returns the number of rotated log files to keep.
+func logMaxBackups(config *AppConfig) int {
+	n, err := strconv.Atoi(config.getKeyVal(keyLogMaxBackups))
+	if err != nil || n < 1 {
+		n, _ = strconv.Atoi(keyLogMaxBackups.def)
+	}
+	return n
+}
+
+// backupTimeFormat names rotated log files, e.g. dynip.log.20240301-083000.gz
+const backupTimeFormat = "20060102-150405"
+
+// logFile is a log file opened for appending, which rotates itself when it
+// grows past maxSize or has been written for longer than maxAge. Rotated
+// files are renamed with a timestamp, optionally compressed, and only the
+// newest backups, rotated within keepFor, are kept.
+type logFile struct {
+	path     string
+	maxSize  int64         // zero for no size limit
+	maxAge   time.Duration // zero for no age limit
+	backups  int
+	keepFor  time.Duration // zero to keep backups of any age
+	compress bool
+	now      func() time.Time
+
+	mux    sync.Mutex
+	f      *os.File
+	size   int64
+	start  time.Time // when the current file was started
+	closed bool      // set by Close; only Reopen opens the file again
+}
+
+// openLogFile opens the log file for appending, creating it if needed, and
+// removes backups that are no longer kept.
+func openLogFile(path string, maxSize int64, maxAge time.Duration, backups int, keepFor time.Duration,
+	compress bool) (*logFile, error) {
+	lf := &logFile{path: path, maxSize: maxSize, maxAge: maxAge, backups: backups, keepFor: keepFor,
+		compress: compress, now: time.Now}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	if err := lf.prune(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not remove old log files: %v\n", err)
+	}
+	return lf, nil
+}
+
+// open opens the file at path. The current file is assumed to have been
+// started when the newest backup was rotated, or now if there is none.
+func (lf *logFile) open() error {
+	f, err := os.OpenFile(lf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	lf.f = f
+	lf.size = fi.Size()
+	lf.start = lf.now()
+	if backups := lf.listBackups(); len(backups) > 0 && fi.Size() > 0 {
+		if t, ok := lf.backupTime(backups[len(backups)-1]); ok {
+			lf.start = t
+		}
+	}
+	return nil
+}
+
+// Write appends p to the log, rotating first if needed. It fails with
+// os.ErrClosed after Close.
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mux.Lock()
+	defer lf.mux.Unlock()
+
+	if lf.closed {
+		return 0, os.ErrClosed
+	}
+	if lf.f == nil {
+		// a previous rotate or Reopen could not open the file
+		if err := lf.open(); err != nil {
+			return 0, err
+		}
+	}
+	if lf.size > 0 && ((lf.maxSize > 0 && lf.size+int64(len(p)) > lf.maxSize) ||
+		(lf.maxAge > 0 && lf.now().Sub(lf.start) >= lf.maxAge)) {
+		if err := lf.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and reopens the log file, such as after an external tool
+// like logrotate has renamed it.
+func (lf *logFile) Reopen() error {
+	lf.mux.Lock()
+	defer lf.mux.Unlock()
+	if lf.f != nil {
+		_ = lf.f.Close()
+		lf.f = nil
+	}
+	lf.closed = false
+	return lf.open()
+}
+
+// Close closes the log file. Later writes fail until Reopen.
+func (lf *logFile) Close() error {
+	lf.mux.Lock()
+	defer lf.mux.Unlock()
+	lf.closed = true
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
+
+// rotate renames the current file to a backup and starts a new one.
+func (lf *logFile) rotate() error {
+	if err := lf.f.Close(); err != nil {
+		return err
+	}
+	lf.f = nil
+
+	now := lf.now()
+	backup := lf.path + "." + now.Format(backupTimeFormat)
+	for i := 1; fileExists(backup) || fileExists(backup+".gz"); i++ {
+		backup = fmt.Sprintf("%s.%s-%d", lf.path, now.Format(backupTimeFormat), i)
+	}
+	rerr := os.Rename(lf.path, backup)
+	if err := lf.open(); err != nil {
+		return err
+	}
+	if rerr != nil {
+		return rerr
+	}
+	lf.start = now
+	if lf.compress {
+		if err := compressFile(backup); err != nil {
+			return err
+		}
+	}
+	return lf.prune()
+}
+
+// listBackups returns the rotated files, oldest first.
+func (lf *logFile) listBackups() []string {
+	matches, _ := filepath.Glob(lf.path + ".*")
+	var backups []string
+	for _, m := range matches {
+		if _, ok := lf.backupTime(m); ok {
+			backups = append(backups, m)
+		}
+	}
+	// the timestamp format sorts by time
+	sort.Strings(backups)
+	return backups
+}
+
+// backupTime returns the time a backup was rotated, from its name.
+func (lf *logFile) backupTime(name string) (time.Time, bool) {
+	suffix := strings.TrimSuffix(strings.TrimPrefix(name, lf.path+"."), ".gz")
+	if len(suffix) < len(backupTimeFormat) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(backupTimeFormat, suffix[:len(backupTimeFormat)], time.Local)
+	return t, err == nil
+}
+
+// prune removes the oldest backups beyond the number to keep, and any
+// rotated longer than keepFor ago.
+func (lf *logFile) prune() error {
+	backups := lf.listBackups()
+	var err error
+	for len(backups) > 0 {
+		if len(backups) <= lf.backups {
+			t, _ := lf.backupTime(backups[0])
+			if lf.keepFor <= 0 || lf.now().Sub(t) < lf.keepFor {
+				break
+			}
+		}
+		if rerr := os.Remove(backups[0]); rerr != nil && err == nil {
+			err = rerr
+		}
+		backups = backups[1:]
+	}
+	return err
+}
+
+// compressFile gzips name to name.gz and removes name.
+func compressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+	_ = in.Close()
+	return os.Remove(name)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// reopener is implemented by log outputs that can be reopened.
+type reopener interface {
+	Reopen() error
+}
+
+// reopenOnHangup reopens the log file whenever SIGHUP is received, until
+// done is closed, so external tools such as logrotate can rotate it.
+// SIGHUP is caught even without a log file, so a reload does not stop the
+// service.
+func reopenOnHangup(logger *logrus.Logger, done <-chan struct{}) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-c:
+			r, ok := logger.Out.(reopener)
+			if !ok {
+				logger.Debug("no log file to reopen")
+			} else if err := r.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "could not reopen log file: %v\n", err)
+			} else {
+				logger.Info("log file reopened")
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Test_logFileAppends(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.log")
+	if err := ioutil.WriteFile(path, []byte("before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := openLogFile(path, 0, 0, 5, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = lf.Write([]byte("after\n"))
+	_ = lf.Close()
+
+	if b, _ := ioutil.ReadFile(path); string(b) != "before\nafter\n" {
+		t.Errorf("log = %q, want previous content kept", b)
+	}
+}
+
+func Test_logFileRotate(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.log")
+
+	now := time.Date(2024, 3, 1, 8, 30, 0, 0, time.Local)
+	lf, err := openLogFile(path, 100, 0, 2, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf.now = func() time.Time { return now }
+	defer lf.Close()
+
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 8; i++ {
+		now = now.Add(time.Minute)
+		if _, err := lf.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups := lf.listBackups()
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2 kept", backups)
+	}
+	if want := path + ".20240301-083800.gz"; backups[1] != want {
+		t.Errorf("newest backup = %s, want %s", backups[1], want)
+	}
+	f, err := os.Open(backups[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); !bytes.Equal(b, line) {
+		t.Errorf("backup = %q, want %q", b, line)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != int64(len(line)) {
+		t.Errorf("current log size = %d, want %d", fi.Size(), len(line))
+	}
+}
+
+func Test_logFileRotateAge(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.log")
+
+	now := time.Date(2024, 3, 1, 8, 30, 0, 0, time.Local)
+	lf, err := openLogFile(path, 0, time.Hour*24, 5, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf.now = func() time.Time { return now }
+	lf.start = now
+
+	_, _ = lf.Write([]byte("day one\n"))
+	now = now.Add(time.Hour * 23)
+	_, _ = lf.Write([]byte("still day one\n"))
+	now = now.Add(time.Hour)
+	_, _ = lf.Write([]byte("day two\n"))
+	_ = lf.Close()
+
+	if b, _ := ioutil.ReadFile(path + ".20240302-083000"); string(b) != "day one\nstill day one\n" {
+		t.Errorf("backup = %q", b)
+	}
+
+	// a restart continues the age from the last rotation
+	lf, err = openLogFile(path, 0, time.Hour*24, 5, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	if want := time.Date(2024, 3, 2, 8, 30, 0, 0, time.Local); !lf.start.Equal(want) {
+		t.Errorf("start = %v, want %v", lf.start, want)
+	}
+}
+
+func Test_logFilePruneAge(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.log")
+
+	old := path + ".20240201-083000.gz"
+	recent := path + ".20240228-083000.gz"
+	writeTestFile(t, old, "old")
+	writeTestFile(t, recent, "recent")
+
+	lf, err := openLogFile(path, 0, 0, 5, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf.keepFor = time.Hour * 24 * 7
+	lf.now = func() time.Time { return time.Date(2024, 3, 1, 8, 30, 0, 0, time.Local) }
+	defer lf.Close()
+	if err := lf.prune(); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(old) {
+		t.Error("backup older than log_max_backup_age was kept")
+	}
+	if !fileExists(recent) {
+		t.Error("recent backup was removed")
+	}
+}
+
+func Test_logfmtFields(t *testing.T) {
+	fields := logrus.Fields{
+		"host":  "test.example.com",
+		"error": errors.New(`bad "token"`),
+		"empty": "",
+		"n":     3,
+		"eq":    "a=b",
+	}
+	want := `empty="" eq="a=b" error="bad \"token\"" host=test.example.com n=3`
+	if got := logfmtFields(fields); got != want {
+		t.Errorf("logfmtFields = %s, want %s", got, want)
+	}
+}
+
+func Test_logFileReopen(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.log")
+
+	lf, err := openLogFile(path, 0, 0, 5, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	_, _ = lf.Write([]byte("one\n"))
+
+	// as logrotate would
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = lf.Write([]byte("two\n"))
+
+	if b, _ := ioutil.ReadFile(path); string(b) != "two\n" {
+		t.Errorf("log = %q, want %q", b, "two\n")
+	}
+}
+
+func Test_logFileClosed(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dynip.log")
+
+	lf, err := openLogFile(path, 0, 0, 5, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lf.Write([]byte("one\n")); err != os.ErrClosed {
+		t.Errorf("Write after Close error = %v, want %v", err, os.ErrClosed)
+	}
+	if fileExists(path) {
+		t.Error("Write after Close recreated the log")
+	}
+
+	if err := lf.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	if _, err := lf.Write([]byte("two\n")); err != nil {
+		t.Errorf("Write after Reopen error = %v", err)
+	}
+}
+
+func Test_logFormatter(t *testing.T) {
+	tests := []struct {
+		format string
+		check  func(string) bool
+	}{
+		{format: "json", check: func(s string) bool {
+			var m map[string]interface{}
+			return json.Unmarshal([]byte(s), &m) == nil && m["msg"] == "hello" && m["host"] == "test.example.com"
+		}},
+		{format: "logfmt", check: func(s string) bool {
+			return strings.HasPrefix(s, "time=") && strings.HasSuffix(s, " level=info msg=hello host=test.example.com\n")
+		}},
+		{format: "text", check: func(s string) bool { return strings.Contains(s, "msg=hello") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &buf
+			logger.Formatter = logFormatter(tt.format)
+			logger.WithField("host", "test.example.com").Info("hello")
+			if !tt.check(buf.String()) {
+				t.Errorf("unexpected %s output: %s", tt.format, buf.String())
+			}
+		})
+	}
+}
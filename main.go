@@ -1,7 +1,7 @@
 package main
 
 import (
-	"flag"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,10 +10,11 @@ import (
 	"path"
 	"runtime"
 	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
-	"github.com/wiggin77/cfg"
 )
 
 // Default config file directory and name.
@@ -23,6 +24,10 @@ const (
 	defaultConfigFile = "dynip.conf"
 )
 
+// exitUsage is the exit code for an invalid command line, the same as the
+// flag package uses for an unknown flag.
+const exitUsage = 2
+
 type appResult struct {
 	exitCode int
 	exitMsg  string
@@ -32,103 +37,46 @@ type appResult struct {
 func main() {
 	result := &appResult{}
 	defer exit(result)
-
-	var fileConfig string
-	var daemon bool
-	var verbose bool
-	var install bool
-	var uninstall bool
-	var version bool
-	var help bool
-	defFileConfig := defConfigFile()
-
-	// process command line flags
-	flag.StringVar(&fileConfig, "f", defFileConfig, "config file")
-	flag.BoolVar(&daemon, "d", false, "run as a daemon")
-	flag.BoolVar(&verbose, "v", false, "overrides verbose setting in config (interactive only)")
-	flag.BoolVar(&install, "i", false, "install as service/daemon")
-	flag.BoolVar(&uninstall, "u", false, "uninstall service/daemon")
-	flag.BoolVar(&version, "version", false, "display version info")
-	flag.BoolVar(&help, "h", false, "display help")
-	flag.Parse()
-
-	// possibly display help
-	if help {
-		flag.PrintDefaults()
-		return
-	}
-
-	// possibly display version info
-	if version {
-		fmt.Println(appVersion)
-		return
-	}
-
-	// possibly install as service
-	if install {
-		err := serviceInstall()
-		if err != nil {
-			result.exitCode = -5
-			result.exitMsg = fmt.Sprintf("%v", err)
-		} else {
-			result.exitMsg = "install successful"
-		}
-		return
-	}
-
-	// possibly uninstall
-	if uninstall {
-		err := serviceUninstall()
-		if err != nil {
-			result.exitCode = -6
-			result.exitMsg = fmt.Sprintf("%v", err)
-		} else {
-			result.exitMsg = "uninstall successful"
-		}
-		return
-	}
-
-	// possibly run as a daemon
-	if daemon {
-		err := serviceRun()
-		if err != nil {
-			result.exitCode = -1
-			result.exitMsg = fmt.Sprintf("%v", err)
-		}
-		return
-	}
-
-	err := runOnce(fileConfig, verbose)
-	if err != nil {
-		result.exitCode = -1
-		result.exitMsg = fmt.Sprintf("%v", err)
-	}
+	runCLI(os.Args[1:], result)
 }
 
-func runOnce(fileConfig string, verbose bool) error {
+// runOnce updates the IP address once and returns a report of the outcome.
+func runOnce(o *cliOpts, output string) updateReports {
+	start := time.Now()
+
 	// load config file
-	appConfig, err := NewAppConfig(fileConfig)
+	appConfig, err := o.loadConfig()
 	if err != nil {
-		return err
-	}
-
-	// if verbose specified on command line it overrides config
-	if verbose {
-		src := cfg.NewSrcMapFromMap(map[string]string{"verbose": "YES"})
-		appConfig.PrependSource(src)
+		report := newUpdateReport(nil)
+		report.setErr(err)
+		report.setDuration(start)
+		return updateReports{report}
 	}
 
 	// configure logger
 	logger, err := configureLogging(appConfig)
 	if err != nil {
-		return err
-	}
-	c, ok := logger.Out.(io.Closer)
-	if ok {
-		defer func() { _ = c.Close() }()
-	}
-	_, err = updateIP(appConfig, logger)
-	return err
+		report := newUpdateReport(appConfig)
+		report.setErr(err)
+		report.setDuration(start)
+		return updateReports{report}
+	}
+	defer closeLog(logger)
+	// keep stdout clean for machine-readable output
+	if output == outputJSON && logger.Out == os.Stdout {
+		logger.Out = os.Stderr
+	}
+
+	// update each host in turn
+	var reports updateReports
+	for _, host := range appConfig.hosts() {
+		start := time.Now()
+		report := newUpdateReport(host)
+		report.setReply(sendUpdate(context.Background(), host, logger))
+		report.setDuration(start)
+		reports = append(reports, report)
+	}
+	return reports
 }
 
 func configureLogging(cfg *AppConfig) (*logrus.Logger, error) {
@@ -140,26 +88,33 @@ func configureLogging(cfg *AppConfig) (*logrus.Logger, error) {
 	logger.Level = log.InfoLevel
 	logger.Out = os.Stdout
 
-	if file != "" {
-		f, err := os.Create(file)
+	logger.Formatter = logFormatter(cfg.getKeyVal(keyLogFormat))
+
+	switch strings.ToLower(file) {
+	case "":
+	case logStdout:
+		logger.Out = os.Stdout
+	case logStderr:
+		logger.Out = os.Stderr
+	default:
+		f, err := openLogFile(file, logMaxSize(cfg), cfg.timeout(keyLogMaxAge), logMaxBackups(cfg),
+			cfg.timeout(keyLogMaxBackupAge), isTrue(cfg.getKeyVal(keyLogCompress)))
 		if err != nil {
 			return nil, err
 		}
 		logger.Out = f
 	}
 	if syslogger {
-		logger.Out = ioutil.Discard
-		if hasSysLog() {
-			hook, err := syslogHook("dynip")
-			if err != nil {
-				return nil, err
-			}
-			if hook != nil {
-				logger.AddHook(hook)
-			}
-		} else {
-			return nil, fmt.Errorf("syslog not supported for %s", runtime.GOOS)
+		// syslog only, unless a log file (or stdout) is also given
+		if file == "" {
+			logger.Out = ioutil.Discard
 		}
+		hook, err := newSyslogHook(cfg)
+		if err != nil {
+			closeLog(logger)
+			return nil, err
+		}
+		logger.AddHook(hook)
 	}
 	if verbose {
 		logger.Level = log.DebugLevel
@@ -167,6 +122,24 @@ func configureLogging(cfg *AppConfig) (*logrus.Logger, error) {
 	return logger, nil
 }
 
+// closeLog closes the log file and syslog connection (if any). Stdout and
+// stderr are left open.
+func closeLog(logger *logrus.Logger) {
+	for _, hooks := range logger.Hooks {
+		for _, hook := range hooks {
+			if sh, ok := hook.(*syslogHook); ok {
+				_ = sh.Close()
+			}
+		}
+	}
+	if logger.Out == os.Stdout || logger.Out == os.Stderr {
+		return
+	}
+	if c, ok := logger.Out.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
 // Get the filespec for the default config file in user's home directory or /etc.
 func defConfigFile() string {
 	home, err := homePath()
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maintenance modes.
+const (
+	maintSuspend = "suspend" // updates are suspended during the window
+	maintOffline = "offline" // the record is set offline during the window
+)
+
+// maxMaintDuration limits the length of a cron maintenance window.
+const maxMaintDuration = time.Hour * 24 * 7
+
+const minutesPerDay = 24 * 60
+const minutesPerWeek = 7 * minutesPerDay
+
+// maintWindow reports whether a time falls within a maintenance window.
+type maintWindow interface {
+	contains(t time.Time) bool
+}
+
+// maintSchedule is the set of maintenance windows configured for a host.
+type maintSchedule struct {
+	windows []maintWindow
+	loc     *time.Location
+	mode    string
+}
+
+// contains returns true if t falls within any of the windows.
+func (ms *maintSchedule) contains(t time.Time) bool {
+	t = t.In(ms.loc)
+	for _, w := range ms.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenance returns the host's maintenance schedule, or nil if it has none.
+func (config *AppConfig) maintenance() (*maintSchedule, error) {
+	spec := config.getKeyVal(keyMaintenance)
+	if spec == "" {
+		return nil, nil
+	}
+	var dur time.Duration
+	if s := config.getKeyVal(keyMaintDuration); s != "" {
+		var err error
+		if dur, err = config.Duration(keyMaintDuration.name, 0); err != nil {
+			return nil, fmt.Errorf("%s: %v", keyMaintDuration.name, err)
+		}
+	}
+	windows, err := parseMaintenance(spec, dur)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", keyMaintenance.name, err)
+	}
+	loc, err := loadTimezone(config.getKeyVal(keyMaintTimezone))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", keyMaintTimezone.name, err)
+	}
+	mode := strings.ToLower(config.getKeyVal(keyMaintMode))
+	return &maintSchedule{windows: windows, loc: loc, mode: mode}, nil
+}
+
+// loadTimezone returns the named IANA time zone, or the local time zone
+// if name is empty or "Local".
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// parseMaintenance parses maintenance windows separated by semicolons.
+// Each window is either "cron" plus a five field cron expression giving
+// the start times, lasting dur, or a day/time range such as "Sat-Sun",
+// "Fri 18:00-Mon 08:00", "Mon-Fri 22:00-06:00" or "12:00-13:00".
+func parseMaintenance(spec string, dur time.Duration) ([]maintWindow, error) {
+	var windows []maintWindow
+	for _, s := range strings.Split(spec, ";") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		var w maintWindow
+		var err error
+		if fields := strings.Fields(s); strings.EqualFold(fields[0], "cron") {
+			w, err = parseCronWindow(fields[1:], dur)
+		} else {
+			w, err = parseWeeklyWindow(s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("'%s': %v", s, err)
+		}
+		windows = append(windows, w)
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no maintenance windows")
+	}
+	return windows, nil
+}
+
+// weeklyWindow is a set of ranges of minutes within the week, starting
+// Sunday 00:00. A range may wrap past the end of the week.
+type weeklyWindow []weekRange
+
+type weekRange struct {
+	start int // minute of the week, inclusive
+	end   int // minute of the week, exclusive; may exceed minutesPerWeek
+}
+
+func (ww weeklyWindow) contains(t time.Time) bool {
+	m := int(t.Weekday())*minutesPerDay + t.Hour()*60 + t.Minute()
+	for _, r := range ww {
+		if (m >= r.start && m < r.end) || (m+minutesPerWeek >= r.start && m+minutesPerWeek < r.end) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	reDay     = `[a-zA-Z]+`
+	reTime    = `\d{1,2}:\d{2}`
+	reDayTime = regexp.MustCompile(`^(` + reDay + `)(?:\s+(` + reTime + `))?\s*-\s*(` + reDay + `)(?:\s+(` + reTime + `))?$`)
+	reDaily   = regexp.MustCompile(`^(?:(\S+)\s+)?(` + reTime + `)\s*-\s*(` + reTime + `)$`)
+)
+
+// parseWeeklyWindow parses a day/time range.
+func parseWeeklyWindow(s string) (weeklyWindow, error) {
+	// "Mon-Fri 22:00-06:00" or "22:00-06:00": a time range on each day
+	if m := reDaily.FindStringSubmatch(s); m != nil {
+		days := []int{0, 1, 2, 3, 4, 5, 6}
+		if m[1] != "" {
+			var err error
+			if days, err = parseDays(m[1]); err != nil {
+				return nil, err
+			}
+		}
+		start, err := parseTimeOfDay(m[2])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeOfDay(m[3])
+		if err != nil {
+			return nil, err
+		}
+		if end <= start {
+			end += minutesPerDay // crosses midnight
+		}
+		var ww weeklyWindow
+		for _, d := range days {
+			ww = append(ww, weekRange{start: d*minutesPerDay + start, end: d*minutesPerDay + end})
+		}
+		return ww, nil
+	}
+
+	// "Fri 18:00-Mon 08:00": from a day and time to a later day and time
+	if m := reDayTime.FindStringSubmatch(s); m != nil && (m[2] == "") == (m[4] == "") && m[2] != "" {
+		d1, err := parseDay(m[1])
+		if err != nil {
+			return nil, err
+		}
+		d2, err := parseDay(m[3])
+		if err != nil {
+			return nil, err
+		}
+		t1, err := parseTimeOfDay(m[2])
+		if err != nil {
+			return nil, err
+		}
+		t2, err := parseTimeOfDay(m[4])
+		if err != nil {
+			return nil, err
+		}
+		start := d1*minutesPerDay + t1
+		end := d2*minutesPerDay + t2
+		if end <= start {
+			end += minutesPerWeek
+		}
+		return weeklyWindow{{start: start, end: end}}, nil
+	}
+
+	// "Sat-Sun" or "Sun": whole days
+	days, err := parseDays(s)
+	if err != nil {
+		return nil, err
+	}
+	var ww weeklyWindow
+	for _, d := range days {
+		ww = append(ww, weekRange{start: d * minutesPerDay, end: (d + 1) * minutesPerDay})
+	}
+	return ww, nil
+}
+
+var dayNames = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// parseDay parses a day name, full or abbreviated to three letters.
+// Sunday is zero.
+func parseDay(s string) (int, error) {
+	s = strings.ToLower(s)
+	for i, name := range dayNames {
+		if len(s) >= 3 && strings.HasPrefix(name, s) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("'%s' is not a day of the week", s)
+}
+
+// parseDays parses a comma separated list of days and day ranges, such
+// as "Mon-Fri,Sun". Ranges may wrap, e.g. "Fri-Mon".
+func parseDays(s string) ([]int, error) {
+	var days []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if i := strings.Index(part, "-"); i != -1 {
+			d1, err := parseDay(strings.TrimSpace(part[:i]))
+			if err != nil {
+				return nil, err
+			}
+			d2, err := parseDay(strings.TrimSpace(part[i+1:]))
+			if err != nil {
+				return nil, err
+			}
+			for d := d1; ; d = (d + 1) % 7 {
+				days = append(days, d)
+				if d == d2 {
+					break
+				}
+			}
+			continue
+		}
+		d, err := parseDay(part)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// parseTimeOfDay parses "HH:MM" as minutes since midnight. "24:00" is
+// allowed as the end of a day.
+func parseTimeOfDay(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("'%s' is not a time of day", s)
+	}
+	return h*60 + m, nil
+}
+
+// cronWindow is a window starting at each time matched by a cron
+// expression and lasting for a duration.
+type cronWindow struct {
+	fields [5]cronField // minute, hour, day of month, month, day of week
+	dur    time.Duration
+}
+
+// cronField holds the values matched by one cron field; all is true for "*".
+type cronField struct {
+	all  bool
+	vals map[int]bool
+}
+
+func parseCronWindow(fields []string, dur time.Duration) (*cronWindow, error) {
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields")
+	}
+	if dur <= 0 {
+		return nil, fmt.Errorf("cron windows require %s", keyMaintDuration.name)
+	}
+	if dur > maxMaintDuration {
+		return nil, fmt.Errorf("%s must not exceed 7 days", keyMaintDuration.name)
+	}
+	cw := &cronWindow{dur: dur}
+	limits := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	names := [5][]string{nil, nil, nil,
+		{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"},
+		{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+	for i, f := range fields {
+		cf, err := parseCronField(f, limits[i][0], limits[i][1], names[i])
+		if err != nil {
+			return nil, err
+		}
+		cw.fields[i] = cf
+	}
+	// Sunday may be 0 or 7
+	if cw.fields[4].vals[7] {
+		cw.fields[4].vals[0] = true
+	}
+	return cw, nil
+}
+
+// parseCronField parses a field such as "*", "*/15", "1-5", "mon,wed".
+func parseCronField(s string, min, max int, names []string) (cronField, error) {
+	cf := cronField{vals: make(map[int]bool)}
+	value := func(v string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(v, name) {
+				return i + min, nil
+			}
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("'%s' is not a valid cron value", v)
+		}
+		return n, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return cf, fmt.Errorf("'%s' is not a valid cron step", part)
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*":
+			if step == 1 {
+				cf.all = true
+			}
+		case strings.Contains(part, "-"):
+			i := strings.Index(part, "-")
+			var err error
+			if lo, err = value(part[:i]); err != nil {
+				return cf, err
+			}
+			if hi, err = value(part[i+1:]); err != nil {
+				return cf, err
+			}
+			if hi < lo {
+				return cf, fmt.Errorf("'%s' is not a valid cron range", part)
+			}
+		default:
+			n, err := value(part)
+			if err != nil {
+				return cf, err
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			cf.vals[v] = true
+		}
+	}
+	return cf, nil
+}
+
+func (cf cronField) match(v int) bool {
+	return cf.all || cf.vals[v]
+}
+
+// matches returns true if t is one of the start times.
+func (cw *cronWindow) matches(t time.Time) bool {
+	if !cw.fields[0].match(t.Minute()) || !cw.fields[1].match(t.Hour()) || !cw.fields[3].match(int(t.Month())) {
+		return false
+	}
+	// as in cron, if both day fields are restricted either may match
+	dom := cw.fields[2].match(t.Day())
+	dow := cw.fields[4].match(int(t.Weekday()))
+	if !cw.fields[2].all && !cw.fields[4].all {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// contains returns true if a start time within the last dur precedes t.
+func (cw *cronWindow) contains(t time.Time) bool {
+	t = t.Truncate(time.Minute)
+	for s := t; t.Sub(s) < cw.dur; s = s.Add(-time.Minute) {
+		if cw.matches(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Test_parseMaintenance(t *testing.T) {
+	// days of the week starting Sunday 2023-12-31
+	at := func(day int, hhmm string) time.Time {
+		tm, err := time.Parse("15:04", hhmm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2023, 12, 31+day, tm.Hour(), tm.Minute(), 0, 0, time.UTC)
+	}
+	const sun, mon, tue, wed, thu, fri, sat = 0, 1, 2, 3, 4, 5, 6
+
+	tests := []struct {
+		spec string
+		dur  time.Duration
+		in   []time.Time
+		out  []time.Time
+	}{
+		{spec: "Sat-Sun", in: []time.Time{at(sat, "00:00"), at(sun, "23:59")},
+			out: []time.Time{at(fri, "23:59"), at(mon, "00:00")}},
+		{spec: "Fri 18:00-Mon 08:00", in: []time.Time{at(fri, "18:00"), at(sun, "12:00"), at(mon, "07:59")},
+			out: []time.Time{at(fri, "17:59"), at(mon, "08:00"), at(wed, "12:00")}},
+		{spec: "Mon-Fri 22:00-06:00", in: []time.Time{at(mon, "22:00"), at(tue, "05:59"), at(sat, "05:00")},
+			out: []time.Time{at(mon, "05:00"), at(sat, "22:00"), at(wed, "12:00")}},
+		{spec: "12:00-13:00; sunday", in: []time.Time{at(wed, "12:30"), at(sun, "08:00")},
+			out: []time.Time{at(wed, "13:00"), at(mon, "08:00")}},
+		{spec: "cron 0 18 * * fri", dur: time.Hour * 62, in: []time.Time{at(fri, "18:00"), at(mon, "07:59")},
+			out: []time.Time{at(fri, "17:59"), at(mon, "08:00")}},
+		{spec: "cron */15 9-17 * * 1-5", dur: time.Minute * 5, in: []time.Time{at(tue, "09:15"), at(tue, "17:49")},
+			out: []time.Time{at(tue, "09:20"), at(sat, "09:15"), at(tue, "18:00")}},
+	}
+	for _, tt := range tests {
+		windows, err := parseMaintenance(tt.spec, tt.dur)
+		if err != nil {
+			t.Errorf("parseMaintenance(%s) error = %v", tt.spec, err)
+			continue
+		}
+		ms := &maintSchedule{windows: windows, loc: time.UTC}
+		for _, tm := range tt.in {
+			if !ms.contains(tm) {
+				t.Errorf("%s: %s should be within the window", tt.spec, tm.Format("Mon 15:04"))
+			}
+		}
+		for _, tm := range tt.out {
+			if ms.contains(tm) {
+				t.Errorf("%s: %s should be outside the window", tt.spec, tm.Format("Mon 15:04"))
+			}
+		}
+	}
+
+	for _, spec := range []string{"", "Funday", "Mon 25:00-26:00", "Fri 18:00-Mon", "cron * * *", "cron 60 * * * *"} {
+		if _, err := parseMaintenance(spec, time.Hour); err == nil {
+			t.Errorf("parseMaintenance(%q) should fail", spec)
+		}
+	}
+	if _, err := parseMaintenance("cron 0 18 * * fri", 0); err == nil {
+		t.Error("cron window without a duration should fail")
+	}
+}
+
+func Test_daemonMaintenance(t *testing.T) {
+	cfg, err := NewAppConfigFromMap(map[string]string{
+		"hostname":             "test.example.com",
+		"username":             "testuser",
+		"token":                "testtoken",
+		"maintenance":          "Sat-Sun",
+		"maintenance_mode":     "offline",
+		"maintenance_timezone": "UTC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlog := logrus.New()
+	tlog.Out = ioutil.Discard
+
+	updates := &scriptedUpdater{}
+	offlines := &scriptedUpdater{}
+	// Friday 2024-01-05 22:00 UTC
+	fc := &fakeClock{now: time.Date(2024, 1, 5, 22, 0, 0, 0, time.UTC)}
+	do := &daemonOpt{appConfig: cfg, logger: tlog, clock: fc, update: updates.update, offline: offlines.update}
+	d := newDaemon(do, time.Hour*12, tlog.WithField("test", "maintenance"))
+
+	// Fri 22:00, Sat 10:00, Sat 22:00, Sun 10:00, Sun 22:00, Mon 10:00
+	want := "U....U"
+	got := make([]byte, 0, len(want))
+	for range want {
+		if d.tick(context.Background()) > 0 {
+			got = append(got, 'U')
+		} else {
+			got = append(got, '.')
+		}
+		fc.now = fc.now.Add(time.Hour * 12)
+	}
+	if string(got) != want {
+		t.Errorf("tick sequence = %s, want %s", got, want)
+	}
+	if offlines.calls != 1 {
+		t.Errorf("set offline %d times, want once as the window starts", offlines.calls)
+	}
+}
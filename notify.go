@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+// Notification events.
+const (
+	eventMaintStart = "maintenance_start"
+	eventMaintEnd   = "maintenance_end"
+	eventFailover   = "failover"
+	eventUpdated    = "updated"
+	eventUpdateFail = "update_failed"
+)
+
+// notify runs the host's notify_command, if any, in the background. The
+// event, hostname and message are passed in the NOTIFY_EVENT, NOTIFY_HOST
+// and NOTIFY_MESSAGE environment variables, along with any extra variables
+// given as NAME=value. The command is killed after notify_timeout or when
+// ctx is done.
+func notify(ctx context.Context, appConfig *AppConfig, log *logrus.Entry, event string, msg string, extra ...string) {
+	command := appConfig.getKeyVal(keyNotifyCommand)
+	if command == "" {
+		return
+	}
+	timeout := appConfig.timeout(keyNotifyTimeout)
+	env := append(os.Environ(),
+		"NOTIFY_EVENT="+event,
+		"NOTIFY_HOST="+appConfig.getKeyVal(keyHostname),
+		"NOTIFY_MESSAGE="+msg)
+	env = append(env, extra...)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+		} else {
+			cmd = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+		}
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.WithFields(logrus.Fields{"event": event, "err": err, "output": string(out)}).Error("notify command failed")
+		}
+	}()
+}
+
+// notifyReply notifies the outcome of an update. The server message is
+// passed as NOTIFY_MESSAGE, or the error if there is no message, and the
+// result, status code and reported address as NOTIFY_RESULT, NOTIFY_CODE
+// and NOTIFY_IP.
+func notifyReply(ctx context.Context, appConfig *AppConfig, log *logrus.Entry, event string, reply *dynip.Reply, err error) {
+	msg := reply.Message
+	if msg == "" && err != nil {
+		msg = err.Error()
+	}
+	notify(ctx, appConfig, log, event, msg,
+		"NOTIFY_RESULT="+string(reply.Result),
+		"NOTIFY_CODE="+reply.Code,
+		"NOTIFY_IP="+reply.IP)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+// offlineIP is the address that tells easyDNS to set a record offline
+// (pointing it at offline.easydns.com).
+const offlineIP = "0.0.0.0"
+
+// offlineFile returns the name of the file listing the hosts set offline
+// with `dynip offline`, kept next to the config file.
+func offlineFile(configFile string) string {
+	return configFile + ".offline"
+}
+
+// readOffline returns the set of hostnames listed in an offline file. A
+// missing file means no hosts are offline.
+func readOffline(file string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return set, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name := strings.ToLower(strings.TrimSpace(scanner.Text())); name != "" {
+			set[name] = true
+		}
+	}
+	return set, scanner.Err()
+}
+
+// writeOffline writes the set of offline hostnames, removing the file when
+// the set is empty.
+func writeOffline(file string, set map[string]bool) error {
+	if len(set) == 0 {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return ioutil.WriteFile(file, []byte(strings.Join(names, "\n")+"\n"), 0644)
+}
+
+// isOffline returns true if the host was set offline with `dynip offline`.
+func (config *AppConfig) isOffline() bool {
+	if config.offline == "" {
+		return false
+	}
+	set, err := readOffline(config.offline)
+	if err != nil {
+		return false
+	}
+	return set[strings.ToLower(config.getKeyVal(keyHostname))]
+}
+
+// sendOffline asks the provider to set the host's record offline.
+func sendOffline(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) (reply *dynip.Reply, err error) {
+	log := logger.WithField("hostname", appConfig.getKeyVal(keyHostname))
+	defer func() {
+		recordHistory(appConfig, log, historyOffline, reply, err)
+	}()
+	token, err := appConfig.getSecretContext(ctx, keyToken)
+	if err != nil {
+		return &dynip.Reply{Result: dynip.LOCALERROR}, err
+	}
+	return sendRequest(ctx, appConfig, log, offlineIP, token)
+}
+
+// setHostsOffline sets every host offline, for offline_on_stop. Requests
+// still in progress when ctx is done are abandoned so stopping the service
+// is not delayed.
+func setHostsOffline(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) {
+	for _, host := range appConfig.hosts() {
+		log := logger.WithField("hostname", host.getKeyVal(keyHostname))
+		if ctx.Err() != nil {
+			log.Error("timed out before setting offline")
+			continue
+		}
+		if reply, err := sendOffline(ctx, host, logger); err != nil {
+			log.WithFields(replyFields(reply)).WithField("err", err).Error("set offline failed")
+		} else {
+			log.WithFields(replyFields(reply)).Info("set offline on stop")
+		}
+	}
+}
+
+// selectHosts returns the hosts matching name, which may be a host section
+// name or a hostname. An empty name selects all hosts.
+func selectHosts(appConfig *AppConfig, name string) ([]*AppConfig, error) {
+	hosts := appConfig.hosts()
+	if name == "" {
+		return hosts, nil
+	}
+	for _, host := range hosts {
+		if strings.EqualFold(host.hostName(), name) || strings.EqualFold(host.getKeyVal(keyHostname), name) {
+			return []*AppConfig{host}, nil
+		}
+	}
+	return nil, fmt.Errorf("no host named '%s' in the config", name)
+}
+
+// cmdOffline runs `dynip offline [host]` or `dynip online [host]`, for
+// every host if name is empty. Offline sets the record offline and stops
+// the daemon and one-shot runs from updating it; online removes that and
+// sends an update straight away.
+func cmdOffline(o *cliOpts, name string, online bool, result *appResult) {
+	appConfig, err := o.loadConfig()
+	if err != nil {
+		result.exitCode = dynip.LOCALERROR.ExitCode()
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	hosts, err := selectHosts(appConfig, name)
+	if err != nil {
+		result.exitCode = -1
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	logger, err := configureLogging(appConfig)
+	if err != nil {
+		result.exitCode = dynip.LOCALERROR.ExitCode()
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+	defer closeLog(logger)
+
+	set, err := readOffline(appConfig.offline)
+	if err != nil {
+		result.exitCode = dynip.LOCALERROR.ExitCode()
+		result.exitMsg = fmt.Sprintf("%v", err)
+		return
+	}
+
+	cmd := "offline"
+	if online {
+		cmd = "online"
+	}
+	var lines []string
+	for _, host := range hosts {
+		hostname := host.getKeyVal(keyHostname)
+		reply := &dynip.Reply{Result: dynip.LOCALERROR}
+		if online {
+			delete(set, strings.ToLower(hostname))
+			if err = writeOffline(appConfig.offline, set); err == nil {
+				reply, err = sendUpdate(context.Background(), host, logger)
+			}
+		} else {
+			if reply, err = sendOffline(context.Background(), host, logger); err == nil {
+				set[strings.ToLower(hostname)] = true
+				err = writeOffline(appConfig.offline, set)
+			}
+		}
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s: %v", hostname, err))
+			if result.exitCode == 0 {
+				result.exitCode = reply.Result.ExitCode()
+				if result.exitCode == 0 {
+					result.exitCode = dynip.LOCALERROR.ExitCode()
+				}
+			}
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s %s", hostname, cmd, reply.Result))
+	}
+	result.exitMsg = strings.Join(lines, "\n")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+func Test_offlineOnline(t *testing.T) {
+	var myips []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		myips = append(myips, r.URL.Query().Get(keyMyIP.name))
+		_, _ = fmt.Fprintln(w, respSUCCESS)
+	}))
+	defer ts.Close()
+	uri, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "dynip.conf")
+	writeTestFile(t, file, fmt.Sprintf("url = %s\nproto = http\nusername = u\ntoken = t\n"+
+		"[office]\nhostname = office.example.com\n[home]\nhostname = home.example.com\n", uri.Host))
+
+	// offline one host by hostname
+	result := &appResult{}
+	cmdOffline(&cliOpts{file: file, format: formatAuto}, "home.example.com", false, result)
+	if result.exitCode != 0 {
+		t.Fatalf("offline failed: %s", result.exitMsg)
+	}
+	if len(myips) != 1 || myips[0] != offlineIP {
+		t.Fatalf("offline sent myip %v, want %s", myips, offlineIP)
+	}
+
+	appConfig, err := NewAppConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !appConfig.host("home").isOffline() || appConfig.host("office").isOffline() {
+		t.Fatal("only home should be offline")
+	}
+	plan, err := makePlan(context.Background(), appConfig.host("home"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Decision != dynip.DecisionOffline {
+		t.Errorf("decision for offline host = %s, want %s", plan.Decision, dynip.DecisionOffline)
+	}
+
+	// online by section name resumes updates
+	myips = nil
+	result = &appResult{}
+	cmdOffline(&cliOpts{file: file, format: formatAuto}, "home", true, result)
+	if result.exitCode != 0 {
+		t.Fatalf("online failed: %s", result.exitMsg)
+	}
+	if len(myips) != 1 || myips[0] == offlineIP {
+		t.Errorf("online sent myip %v, want an update", myips)
+	}
+	if appConfig.host("home").isOffline() {
+		t.Error("home still offline")
+	}
+	if _, err := os.Stat(offlineFile(file)); !os.IsNotExist(err) {
+		t.Error("offline file not removed when no hosts are offline")
+	}
+
+	// unknown host
+	result = &appResult{}
+	cmdOffline(&cliOpts{file: file, format: formatAuto}, "nowhere", false, result)
+	if result.exitCode == 0 || !strings.Contains(result.exitMsg, "nowhere") {
+		t.Errorf("unknown host: exit %d, %s", result.exitCode, result.exitMsg)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+// Output formats for one-shot updates.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// updateReport describes the outcome of a one-shot update in a form
+// suitable for scripts and configuration management tools.
+type updateReport struct {
+	Hostname   string       `json:"hostname"`
+	Provider   string       `json:"provider"`
+	DetectedIP string       `json:"detected_ip"`
+	SentIP     string       `json:"sent_ip"`
+	Result     dynip.Result `json:"result"`
+	ExitCode   int          `json:"exit_code"`
+	ServerCode string       `json:"server_code,omitempty"`
+	Message    string       `json:"message"`
+	IP         string       `json:"ip,omitempty"`
+	Duration   float64      `json:"duration_sec"`
+	Error      string       `json:"error,omitempty"`
+
+	err error
+}
+
+// newUpdateReport creates a report for the host configured in appConfig.
+// appConfig may be nil if the config could not be loaded.
+func newUpdateReport(appConfig *AppConfig) *updateReport {
+	report := &updateReport{Provider: providerName, Result: dynip.LOCALERROR}
+	if appConfig != nil {
+		report.Hostname = appConfig.getKeyVal(keyHostname)
+		report.SentIP = appConfig.getKeyVal(keyMyIP)
+	}
+	return report
+}
+
+// setReply records the server reply and any error from an update.
+func (report *updateReport) setReply(reply *dynip.Reply, err error) {
+	report.Result = reply.Result
+	report.ServerCode = reply.Code
+	report.Message = reply.Message
+	report.IP = reply.IP
+	if reply.Plan != nil {
+		report.SentIP = reply.Plan.SentIP
+		report.DetectedIP = reply.Plan.DetectedIP
+	}
+	report.setErr(err)
+}
+
+// setErr records an error. The result is left unchanged.
+func (report *updateReport) setErr(err error) {
+	report.err = err
+	if err != nil {
+		report.Error = err.Error()
+	}
+}
+
+// setDuration records the elapsed time since start.
+func (report *updateReport) setDuration(start time.Time) {
+	report.Duration = time.Since(start).Seconds()
+}
+
+// exitCode returns the process exit code for the report's result.
+func (report *updateReport) exitCode() int {
+	report.ExitCode = report.Result.ExitCode()
+	return report.ExitCode
+}
+
+// text returns the one line summary printed in text mode: the error
+// if the update failed, otherwise the result code.
+func (report *updateReport) text() string {
+	if report.err != nil {
+		return report.err.Error()
+	}
+	return string(report.Result)
+}
+
+// writeJSON outputs the report to w as an indented JSON document.
+func (report *updateReport) writeJSON(w io.Writer) error {
+	report.exitCode()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(report)
+}
+
+// updateReports holds the report for each host updated by a one-shot run.
+type updateReports []*updateReport
+
+// exitCode returns the exit code of the first report that did not
+// succeed, or zero if all succeeded.
+func (reports updateReports) exitCode() int {
+	code := 0
+	for _, report := range reports {
+		if c := report.exitCode(); c != 0 && code == 0 {
+			code = c
+		}
+	}
+	return code
+}
+
+// text returns the summary printed in text mode. With more than one host
+// each line is prefixed with the hostname.
+func (reports updateReports) text() string {
+	if len(reports) == 1 {
+		return reports[0].text()
+	}
+	lines := make([]string, 0, len(reports))
+	for _, report := range reports {
+		lines = append(lines, report.Hostname+": "+report.text())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeJSON outputs a single report as a JSON object, or multiple reports
+// as a JSON array.
+func (reports updateReports) writeJSON(w io.Writer) error {
+	if len(reports) == 1 {
+		return reports[0].writeJSON(w)
+	}
+	reports.exitCode()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(reports)
+}
+
+// checkOutputFormat returns an error if format is not supported.
+func checkOutputFormat(format string) error {
+	switch format {
+	case outputText, outputJSON:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format '%s'; must be %s or %s", format, outputText, outputJSON)
+}
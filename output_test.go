@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+func Test_updateReportSetReply(t *testing.T) {
+	report := newUpdateReport(nil)
+	reply := &dynip.Reply{Result: dynip.SUCCESS, Code: "OK", IP: "203.0.113.5",
+		Plan: &dynip.Plan{SentIP: ""}}
+	report.setReply(reply, nil)
+	if report.DetectedIP != "" || report.IP != "203.0.113.5" {
+		t.Errorf("detected_ip = %q, ip = %q; want empty, 203.0.113.5", report.DetectedIP, report.IP)
+	}
+
+	reply.Plan = &dynip.Plan{DetectedIP: "198.51.100.7", SentIP: "198.51.100.7"}
+	report.setReply(reply, nil)
+	if report.DetectedIP != "198.51.100.7" || report.SentIP != "198.51.100.7" || report.IP != "203.0.113.5" {
+		t.Errorf("report = %+v", report)
+	}
+}
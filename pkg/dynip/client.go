@@ -0,0 +1,139 @@
+package dynip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Client updates hostnames using a Provider.
+type Client struct {
+	// Provider sends the update requests. Required.
+	Provider Provider
+	// Detector finds the address to publish. If nil, detection is left
+	// to the provider and Host.MyIP is sent.
+	Detector Detector
+	// State reports the current address of a hostname. If nil, DNS is
+	// used.
+	State State
+	// SkipUnchanged skips the update when State already has the detected
+	// address. Otherwise the update is sent anyway, since a stale or
+	// split-horizon answer would suppress a needed update.
+	SkipUnchanged bool
+	// PublicOnly blocks the update when the detected address is private,
+	// shared, link-local or loopback.
+	PublicOnly bool
+}
+
+// Plan detects the IP address, if a Detector is set, and decides whether
+// an update should be sent. The provider is not contacted.
+func (c *Client) Plan(ctx context.Context, host *Host) (*Plan, error) {
+	plan := &Plan{SentIP: host.myIP()}
+
+	if host.Offline {
+		plan.Decision = DecisionOffline
+		plan.Reason = fmt.Sprintf("%s is offline", host.Hostname)
+		return plan, nil
+	}
+
+	var ip string
+	if c.Detector != nil {
+		var err error
+		ip, err = c.Detector.Detect(ctx)
+		if pe, ok := err.(*ProxyError); ok {
+			return nil, &ProxyError{Err: fmt.Errorf("detect: %v", pe.Err)}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("detect: %v", err)
+		}
+	}
+	if ip == "" {
+		plan.Decision = DecisionUpdate
+		plan.Reason = fmt.Sprintf("address detection left to provider (myip=%s)", plan.SentIP)
+		return plan, nil
+	}
+	plan.DetectedIP = ip
+	plan.SentIP = ip
+
+	public := IsPublicIP(ip)
+	if !public && c.PublicOnly {
+		plan.Decision = DecisionBlocked
+		plan.Reason = fmt.Sprintf("detected address %s is not a public address", ip)
+		return plan, nil
+	}
+
+	plan.Decision = DecisionUpdate
+	plan.Reason = fmt.Sprintf("%s does not resolve to %s", host.Hostname, ip)
+	if c.resolvesTo(ctx, host.Hostname, ip) {
+		if c.SkipUnchanged {
+			plan.Decision = DecisionUnchanged
+			plan.Reason = fmt.Sprintf("%s already resolves to %s", host.Hostname, ip)
+			return plan, nil
+		}
+		plan.Reason = fmt.Sprintf("%s already resolves to %s; updating anyway", host.Hostname, ip)
+	}
+	if !public {
+		plan.Reason += fmt.Sprintf("; %s is not a public address", ip)
+	}
+	return plan, nil
+}
+
+// resolvesTo returns true if State has ip for the hostname.
+func (c *Client) resolvesTo(ctx context.Context, hostname string, ip string) bool {
+	addrs, err := c.state().Lookup(ctx, hostname)
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if net.ParseIP(addr).Equal(net.ParseIP(ip)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Update points the host at the detected address, unless the plan says
+// no update is needed. The reply is never nil.
+func (c *Client) Update(ctx context.Context, host *Host) (*Reply, error) {
+	plan, err := c.Plan(ctx, host)
+	if err != nil {
+		reply := &Reply{Result: LOCALERROR}
+		if IsProxyError(err) {
+			reply.Result = PROXYERROR
+		}
+		return reply, err
+	}
+	return c.Send(ctx, host, plan)
+}
+
+// Send carries out a plan made by Plan.
+func (c *Client) Send(ctx context.Context, host *Host, plan *Plan) (*Reply, error) {
+	switch plan.Decision {
+	case DecisionUnchanged, DecisionOffline:
+		return &Reply{Result: NOCHANGE, Message: plan.Reason, Plan: plan}, nil
+	case DecisionBlocked:
+		reply := &Reply{Result: BLOCKED, Message: plan.Reason, Plan: plan}
+		return reply, fmt.Errorf("%v: %s", BLOCKED, plan.Reason)
+	}
+	if c.Provider == nil {
+		return &Reply{Result: LOCALERROR, Plan: plan}, errors.New("no provider")
+	}
+
+	reply, err := c.Provider.Update(ctx, host, plan.SentIP)
+	if reply == nil {
+		reply = &Reply{Result: LOCALERROR}
+	}
+	reply.Plan = plan
+	if err == nil && reply.Result == SUCCESS && plan.DetectedIP != "" {
+		c.state().Store(host.Hostname, plan.DetectedIP)
+	}
+	return reply, err
+}
+
+func (c *Client) state() State {
+	if c.State == nil {
+		return &DNSState{}
+	}
+	return c.State
+}
@@ -0,0 +1,117 @@
+package dynip
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeProvider records update requests and replies with result.
+type fakeProvider struct {
+	result Result
+	sent   []string
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Update(ctx context.Context, host *Host, ip string) (*Reply, error) {
+	p.sent = append(p.sent, ip)
+	if !p.result.Success() {
+		return &Reply{Result: p.result}, errors.New(string(p.result))
+	}
+	return &Reply{Result: p.result, IP: ip}, nil
+}
+
+func staticIP(ip string) Detector {
+	return DetectorFunc(func(ctx context.Context) (string, error) {
+		return ip, nil
+	})
+}
+
+func TestClient_Plan(t *testing.T) {
+	state := &MemoryState{}
+	state.Store("test.example.com", "203.0.113.10")
+
+	tests := []struct {
+		name     string
+		detector Detector
+		offline  bool
+		policy   bool // SkipUnchanged and PublicOnly
+		want     Decision
+		wantSent string
+	}{
+		{name: "provider detects", want: DecisionUpdate, wantSent: DefaultMyIP},
+		{name: "changed", detector: staticIP("203.0.113.20"), want: DecisionUpdate, wantSent: "203.0.113.20"},
+		{name: "unchanged", detector: staticIP("203.0.113.10"), want: DecisionUpdate, wantSent: "203.0.113.10"},
+		{name: "unchanged skipped", detector: staticIP("203.0.113.10"), policy: true, want: DecisionUnchanged, wantSent: "203.0.113.10"},
+		{name: "private", detector: staticIP("192.168.1.5"), want: DecisionUpdate, wantSent: "192.168.1.5"},
+		{name: "private blocked", detector: staticIP("192.168.1.5"), policy: true, want: DecisionBlocked, wantSent: "192.168.1.5"},
+		{name: "offline", detector: staticIP("203.0.113.20"), offline: true, want: DecisionOffline, wantSent: DefaultMyIP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Detector: tt.detector, State: state, SkipUnchanged: tt.policy, PublicOnly: tt.policy}
+			plan, err := c.Plan(context.Background(), &Host{Hostname: "test.example.com", Offline: tt.offline})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan.Decision != tt.want || plan.SentIP != tt.wantSent {
+				t.Errorf("Plan() = %s %s, want %s %s", plan.Decision, plan.SentIP, tt.want, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	provider := &fakeProvider{result: SUCCESS}
+	ip := "203.0.113.20"
+	c := &Client{
+		Provider: provider,
+		Detector: DetectorFunc(func(ctx context.Context) (string, error) { return ip, nil }),
+		State:    &MemoryState{},
+
+		SkipUnchanged: true,
+		PublicOnly:    true,
+	}
+	host := &Host{Hostname: "test.example.com"}
+
+	// the second update is skipped since the state has the address
+	for i := 0; i < 2; i++ {
+		reply, err := c.Update(context.Background(), host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []Result{SUCCESS, NOCHANGE}[i]; reply.Result != want {
+			t.Errorf("update %d: result = %v, want %v", i, reply.Result, want)
+		}
+		if reply.Plan == nil || reply.Plan.SentIP != ip {
+			t.Errorf("update %d: plan = %v", i, reply.Plan)
+		}
+	}
+	if len(provider.sent) != 1 {
+		t.Errorf("provider called %d times, want 1", len(provider.sent))
+	}
+
+	ip = "10.0.0.1"
+	if reply, err := c.Update(context.Background(), host); err == nil || reply.Result != BLOCKED {
+		t.Errorf("private address: %v, %v; want BLOCKED error", reply.Result, err)
+	}
+
+	ip = "203.0.113.30"
+	provider.result = TOOSOON
+	if reply, err := c.Update(context.Background(), host); err == nil || reply.Result != TOOSOON {
+		t.Errorf("rejected update: %v, %v; want TOO_SOON error", reply.Result, err)
+	}
+	if addrs, _ := c.State.Lookup(context.Background(), host.Hostname); len(addrs) != 1 || addrs[0] != "203.0.113.20" {
+		t.Errorf("state after failed update = %v", addrs)
+	}
+
+	c.Detector = DetectorFunc(func(ctx context.Context) (string, error) {
+		return "", &ProxyError{Err: errors.New("connection refused")}
+	})
+	if reply, err := c.Update(context.Background(), host); !IsProxyError(err) || reply.Result != PROXYERROR {
+		t.Errorf("proxy failure: %v, %v; want PROXY_ERROR", reply.Result, err)
+	}
+}
@@ -0,0 +1,107 @@
+package dynip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Detector finds the IP address to publish.
+type Detector interface {
+	// Detect returns the address, or empty string to leave detection to
+	// the provider.
+	Detect(ctx context.Context) (string, error)
+}
+
+// DetectorFunc adapts a function to the Detector interface.
+type DetectorFunc func(ctx context.Context) (string, error)
+
+// Detect calls f(ctx).
+func (f DetectorFunc) Detect(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// URLDetector fetches a URL and expects an IP address as the response body.
+type URLDetector struct {
+	URL string
+	// Client makes the request. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Detect fetches the URL and parses the response body as an IP address.
+func (d *URLDetector) Detect(ctx context.Context) (string, error) {
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest("GET", d.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", checkProxyError(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := checkProxyResponse(resp); err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("detect url returned %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	s := strings.TrimSpace(string(body))
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "", fmt.Errorf("detect url returned '%s' which is not an IP address", s)
+	}
+	return ip.String(), nil
+}
+
+// InterfaceDetector uses the address of a network interface.
+type InterfaceDetector struct {
+	Name string
+}
+
+// Detect returns InterfaceAddr(d.Name).
+func (d *InterfaceDetector) Detect(ctx context.Context) (string, error) {
+	return InterfaceAddr(d.Name)
+}
+
+// InterfaceAddr returns the first global unicast address of the named
+// network interface, preferring IPv4.
+func InterfaceAddr(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	var v6 net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || !ipnet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP.String(), nil
+		}
+		if v6 == nil {
+			v6 = ipnet.IP
+		}
+	}
+	if v6 != nil {
+		return v6.String(), nil
+	}
+	return "", fmt.Errorf("no global unicast address on interface %s", name)
+}
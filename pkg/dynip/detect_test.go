@@ -0,0 +1,49 @@
+package dynip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestURLDetector(t *testing.T) {
+	var body string
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = fmt.Fprintln(w, body)
+	}))
+	defer ts.Close()
+	d := &URLDetector{URL: ts.URL}
+
+	body = " 203.0.113.7 "
+	if ip, err := d.Detect(context.Background()); err != nil || ip != "203.0.113.7" {
+		t.Errorf("Detect() = %q, %v", ip, err)
+	}
+	body = "<html>hello</html>"
+	if _, err := d.Detect(context.Background()); err == nil {
+		t.Error("Detect() should fail for a body that is not an address")
+	}
+	body = "203.0.113.7"
+	status = http.StatusServiceUnavailable
+	if _, err := d.Detect(context.Background()); err == nil {
+		t.Error("Detect() should fail for an error status")
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	public := []string{"203.0.113.7", "8.8.8.8", "2001:db8::1"}
+	private := []string{"10.1.2.3", "172.16.0.1", "192.168.1.1", "100.64.0.1", "127.0.0.1", "fe80::1", "fd00::1", "::1", "bogus"}
+	for _, ip := range public {
+		if !IsPublicIP(ip) {
+			t.Errorf("IsPublicIP(%s) = false", ip)
+		}
+	}
+	for _, ip := range private {
+		if IsPublicIP(ip) {
+			t.Errorf("IsPublicIP(%s) = true", ip)
+		}
+	}
+}
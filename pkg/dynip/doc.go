@@ -0,0 +1,19 @@
+// Package dynip updates dynamic DNS records.
+//
+// A Client combines a Provider, which sends update requests to a dynamic
+// DNS service, an optional Detector, which finds the address to publish,
+// and a State, which reports the address a hostname already has so that
+// unnecessary updates are skipped:
+//
+//	client := &dynip.Client{
+//		Provider: &dynip.EasyDNS{},
+//		Detector: &dynip.URLDetector{URL: "https://api.ipify.org"},
+//	}
+//	reply, err := client.Update(ctx, &dynip.Host{
+//		Hostname: "office.example.com",
+//		Username: "user",
+//		Token:    "token",
+//	})
+//
+// The dynip command is built on this package.
+package dynip
@@ -0,0 +1,325 @@
+// Package dyniptest provides a fake dynamic DNS provider for tests and
+// staging, so updates can be exercised without touching real accounts.
+//
+// Server emulates the easyDNS generic.php API at EasyDNSPath and the
+// dyndns2 protocol at DynDNS2Path. It checks credentials, keeps a record
+// per host, rejects updates made too soon after the previous one and
+// reports hosts without dynamic DNS enabled:
+//
+//	fake := dyniptest.NewServer()
+//	fake.AddAccount("user", "token")
+//	fake.AddHost("user", "office.example.com", "")
+//	ts := httptest.NewServer(fake)
+//	defer ts.Close()
+//
+//	provider := &dynip.EasyDNS{URL: fake.URL(ts), Proto: "http"}
+package dyniptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Paths served by Server.
+const (
+	// EasyDNSPath is the easyDNS update API.
+	EasyDNSPath = "/dyn/generic.php"
+	// DynDNS2Path is the dyndns2 update API.
+	DynDNS2Path = "/nic/update"
+	// RecordsPath returns all records as a JSON array.
+	RecordsPath = "/records"
+)
+
+// Addresses with a special meaning when sent as myip.
+const (
+	// DetectIP asks easyDNS to use the address the request came from.
+	DetectIP = "1.1.1.1"
+	// OfflineIP sets the record offline.
+	OfflineIP = "0.0.0.0"
+)
+
+// Record is the state of one hostname.
+type Record struct {
+	Hostname  string    `json:"hostname"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	Offline   bool      `json:"offline"`
+	NoService bool      `json:"no_service"`
+	Updates   int       `json:"updates"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Server is a fake dynamic DNS provider. It is an http.Handler.
+type Server struct {
+	// MinInterval is the minimum time between updates of a host. Sooner
+	// requests fail with TOO_FREQ (easyDNS) or abuse (dyndns2). Zero
+	// disables the limit.
+	MinInterval time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+	// Logf, if set, logs each request.
+	Logf func(format string, args ...interface{})
+
+	mux      sync.Mutex
+	accounts map[string]string
+	records  map[string]*Record
+	handler  *http.ServeMux
+}
+
+// NewServer creates a server with no accounts.
+func NewServer() *Server {
+	s := &Server{
+		accounts: make(map[string]string),
+		records:  make(map[string]*Record),
+		handler:  http.NewServeMux(),
+	}
+	s.handler.HandleFunc(EasyDNSPath, s.serveEasyDNS)
+	s.handler.HandleFunc(DynDNS2Path, s.serveDynDNS2)
+	s.handler.HandleFunc(RecordsPath, s.serveRecords)
+	return s
+}
+
+// AddAccount adds an account, or changes its token.
+func (s *Server) AddAccount(username string, token string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.accounts[username] = token
+}
+
+// AddHost adds a hostname belonging to the account, with ip as its
+// current address (may be empty).
+func (s *Server) AddHost(username string, hostname string, ip string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.records[strings.ToLower(hostname)] = &Record{Hostname: hostname, Username: username, IP: ip}
+}
+
+// SetNoService sets whether dynamic DNS is disabled for the hostname.
+// Updates of a disabled host fail with NO_SERVICE (easyDNS) or nohost
+// (dyndns2).
+func (s *Server) SetNoService(hostname string, disabled bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if rec, ok := s.records[strings.ToLower(hostname)]; ok {
+		rec.NoService = disabled
+	}
+}
+
+// Record returns a copy of the hostname's record.
+func (s *Server) Record(hostname string) (Record, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if rec, ok := s.records[strings.ToLower(hostname)]; ok {
+		return *rec, true
+	}
+	return Record{}, false
+}
+
+// Records returns a copy of every record, sorted by hostname.
+func (s *Server) Records() []Record {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	arr := make([]Record, 0, len(s.records))
+	for _, rec := range s.records {
+		arr = append(arr, *rec)
+	}
+	sort.Slice(arr, func(i, j int) bool { return arr[i].Hostname < arr[j].Hostname })
+	return arr
+}
+
+// URL returns the easyDNS update URL of a test server running s, in the
+// form used by the url config key and EasyDNS.URL (without scheme).
+func (s *Server) URL(ts *httptest.Server) string {
+	return strings.TrimPrefix(strings.TrimPrefix(ts.URL, "http://"), "https://") + EasyDNSPath
+}
+
+// ServeHTTP handles update requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// status is the outcome of an update request, independent of protocol.
+type status int
+
+const (
+	statusGood status = iota
+	statusNoChange
+	statusBadAuth
+	statusNoHost
+	statusNotYours
+	statusNoService
+	statusIllegal
+	statusTooSoon
+)
+
+// update applies an update request for one hostname.
+func (s *Server) update(username string, token string, hostname string, ip string) (status, *Record) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if t, ok := s.accounts[username]; !ok || t != token || token == "" {
+		return statusBadAuth, nil
+	}
+	if hostname == "" || !strings.Contains(hostname, ".") {
+		return statusIllegal, nil
+	}
+	rec, ok := s.records[strings.ToLower(hostname)]
+	if !ok {
+		return statusNoHost, nil
+	}
+	if rec.Username != username {
+		return statusNotYours, rec
+	}
+	if rec.NoService {
+		return statusNoService, rec
+	}
+	now := s.now()
+	if s.MinInterval > 0 && !rec.Updated.IsZero() && now.Sub(rec.Updated) < s.MinInterval {
+		return statusTooSoon, rec
+	}
+	rec.Updated = now
+	rec.Updates++
+
+	offline := ip == OfflineIP
+	if rec.IP == ip && rec.Offline == offline {
+		return statusNoChange, rec
+	}
+	rec.IP = ip
+	rec.Offline = offline
+	return statusGood, rec
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// remoteIP returns the address the request came from.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// easyDNSCodes are the response codes for each status.
+var easyDNSCodes = map[status]string{
+	statusGood:      "OK",
+	statusNoChange:  "OK",
+	statusBadAuth:   "NO_AUTH",
+	statusNoHost:    "NO_SERVICE",
+	statusNotYours:  "NO_AUTH",
+	statusNoService: "NO_SERVICE",
+	statusIllegal:   "ILLEGAL_INPUT",
+	statusTooSoon:   "TOO_FREQ",
+}
+
+func (s *Server) serveEasyDNS(w http.ResponseWriter, r *http.Request) {
+	username, token, _ := r.BasicAuth()
+	q := r.URL.Query()
+	hostname := q.Get("hostname")
+
+	ip := q.Get("myip")
+	st := statusGood
+	switch {
+	case ip == "" || ip == DetectIP:
+		ip = remoteIP(r)
+	case net.ParseIP(ip) == nil:
+		st = statusIllegal
+	}
+	var rec *Record
+	if st == statusGood {
+		st, rec = s.update(username, token, hostname, ip)
+	}
+
+	var msg string
+	switch st {
+	case statusGood:
+		msg = fmt.Sprintf("%s updated to %s", hostname, rec.IP)
+	case statusNoChange:
+		msg = fmt.Sprintf("no update required for %s to %s", hostname, rec.IP)
+	case statusBadAuth, statusNotYours:
+		msg = fmt.Sprintf("Failed login attempt logged: user %s, host %s, from %s", username, hostname, remoteIP(r))
+	case statusNoHost, statusNoService:
+		msg = fmt.Sprintf("Dynamic DNS is not enabled for %s", hostname)
+	case statusIllegal:
+		msg = fmt.Sprintf("Illegal input: hostname '%s', myip '%s'", hostname, q.Get("myip"))
+	case statusTooSoon:
+		msg = fmt.Sprintf("Increase your time between updates for %s to %d seconds or more.", hostname, int(s.MinInterval.Seconds()))
+	}
+	code := easyDNSCodes[st]
+	s.logf("easydns: %s %s %s: %s", username, hostname, ip, code)
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, "<HTML><BODY><FONT FACE=\"sans-serif\" SIZE=\"-1\">%s<br />\n<hr noshade size=\"1\">\n%s<br />\n</FONT></BODY></HTML>\n", code, msg)
+}
+
+func (s *Server) serveDynDNS2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	username, token, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="dyndns2"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "badauth")
+		return
+	}
+	q := r.URL.Query()
+
+	// dyndns2 falls back to the request address for a missing or invalid myip
+	ip := q.Get("myip")
+	if net.ParseIP(ip) == nil {
+		ip = remoteIP(r)
+	}
+
+	var lines []string
+	for _, hostname := range strings.Split(q.Get("hostname"), ",") {
+		hostname = strings.TrimSpace(hostname)
+		st, _ := s.update(username, token, hostname, ip)
+		var line string
+		switch st {
+		case statusGood:
+			line = "good " + ip
+		case statusNoChange:
+			line = "nochg " + ip
+		case statusBadAuth:
+			line = "badauth"
+		case statusNoHost, statusNoService:
+			line = "nohost"
+		case statusNotYours:
+			line = "!yours"
+		case statusIllegal:
+			line = "notfqdn"
+		case statusTooSoon:
+			line = "abuse"
+		}
+		s.logf("dyndns2: %s %s %s: %s", username, hostname, ip, line)
+		lines = append(lines, line)
+		if st == statusBadAuth {
+			break
+		}
+	}
+	fmt.Fprintln(w, strings.Join(lines, "\n"))
+}
+
+func (s *Server) serveRecords(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(s.Records())
+}
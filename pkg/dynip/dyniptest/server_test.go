@@ -0,0 +1,136 @@
+package dyniptest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+func newTestServer() (*Server, *httptest.Server, *time.Time) {
+	now := time.Now()
+	fake := NewServer()
+	fake.MinInterval = time.Minute * 10
+	fake.Now = func() time.Time { return now }
+	fake.AddAccount("alice", "secret")
+	fake.AddAccount("bob", "hunter2")
+	fake.AddHost("alice", "office.example.com", "203.0.113.1")
+	fake.AddHost("alice", "disabled.example.com", "")
+	fake.SetNoService("disabled.example.com", true)
+	fake.AddHost("bob", "bob.example.com", "")
+	return fake, httptest.NewServer(fake), &now
+}
+
+func TestServer_EasyDNS(t *testing.T) {
+	fake, ts, now := newTestServer()
+	defer ts.Close()
+	provider := &dynip.EasyDNS{URL: fake.URL(ts), Proto: "http"}
+
+	tests := []struct {
+		name  string
+		host  dynip.Host
+		ip    string
+		wait  time.Duration
+		want  dynip.Result
+		inMsg string
+	}{
+		{name: "update", host: dynip.Host{Hostname: "office.example.com", Username: "alice", Token: "secret"},
+			ip: "203.0.113.2", want: dynip.SUCCESS, inMsg: "updated to 203.0.113.2"},
+		{name: "too soon", host: dynip.Host{Hostname: "office.example.com", Username: "alice", Token: "secret"},
+			ip: "203.0.113.3", wait: time.Minute, want: dynip.TOOSOON, inMsg: "600 seconds"},
+		{name: "unchanged", host: dynip.Host{Hostname: "office.example.com", Username: "alice", Token: "secret"},
+			ip: "203.0.113.2", wait: time.Minute * 10, want: dynip.NOCHANGE, inMsg: "no update required"},
+		{name: "detect", host: dynip.Host{Hostname: "office.example.com", Username: "alice", Token: "secret"},
+			ip: DetectIP, wait: time.Minute * 10, want: dynip.SUCCESS, inMsg: "updated to 127.0.0.1"},
+		{name: "bad token", host: dynip.Host{Hostname: "office.example.com", Username: "alice", Token: "wrong"},
+			ip: "203.0.113.2", want: dynip.NOAUTH},
+		{name: "not yours", host: dynip.Host{Hostname: "office.example.com", Username: "bob", Token: "hunter2"},
+			ip: "203.0.113.2", want: dynip.NOAUTH},
+		{name: "unknown host", host: dynip.Host{Hostname: "nope.example.com", Username: "alice", Token: "secret"},
+			ip: "203.0.113.2", want: dynip.NOSERVICE},
+		{name: "no service", host: dynip.Host{Hostname: "disabled.example.com", Username: "alice", Token: "secret"},
+			ip: "203.0.113.2", want: dynip.NOSERVICE},
+		{name: "bad ip", host: dynip.Host{Hostname: "bob.example.com", Username: "bob", Token: "hunter2"},
+			ip: "999.1.1.1", want: dynip.ILLEGALINPUT},
+		{name: "offline", host: dynip.Host{Hostname: "bob.example.com", Username: "bob", Token: "hunter2"},
+			ip: OfflineIP, want: dynip.SUCCESS},
+	}
+	for _, tt := range tests {
+		*now = now.Add(tt.wait)
+		reply, _ := provider.Update(context.Background(), &tt.host, tt.ip)
+		if reply.Result != tt.want {
+			t.Errorf("%s: result = %v, want %v (%s)", tt.name, reply.Result, tt.want, reply.Message)
+		}
+		if !strings.Contains(reply.Message, tt.inMsg) {
+			t.Errorf("%s: message %q does not contain %q", tt.name, reply.Message, tt.inMsg)
+		}
+	}
+
+	rec, ok := fake.Record("office.example.com")
+	if !ok || rec.IP != "127.0.0.1" || rec.Updates != 3 {
+		t.Errorf("office record = %+v", rec)
+	}
+	if rec, _ = fake.Record("bob.example.com"); !rec.Offline {
+		t.Errorf("bob record = %+v, want offline", rec)
+	}
+	if n := len(fake.Records()); n != 3 {
+		t.Errorf("%d records, want 3", n)
+	}
+}
+
+func TestServer_DynDNS2(t *testing.T) {
+	_, ts, now := newTestServer()
+	defer ts.Close()
+
+	get := func(user, token, query string) (int, string) {
+		req, err := http.NewRequest("GET", ts.URL+DynDNS2Path+"?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user != "" {
+			req.SetBasicAuth(user, token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	tests := []struct {
+		name       string
+		user       string
+		token      string
+		query      string
+		wait       time.Duration
+		wantStatus int
+		want       string
+	}{
+		{name: "no auth", query: "hostname=office.example.com", wantStatus: http.StatusUnauthorized, want: "badauth"},
+		{name: "bad token", user: "alice", token: "wrong", query: "hostname=office.example.com", want: "badauth"},
+		{name: "good", user: "alice", token: "secret", query: "hostname=office.example.com&myip=203.0.113.9", want: "good 203.0.113.9"},
+		{name: "abuse", user: "alice", token: "secret", query: "hostname=office.example.com&myip=203.0.113.9", wait: time.Minute, want: "abuse"},
+		{name: "nochg", user: "alice", token: "secret", query: "hostname=office.example.com&myip=203.0.113.9", wait: time.Minute * 10, want: "nochg 203.0.113.9"},
+		{name: "several", user: "bob", token: "hunter2", query: "hostname=bob.example.com,office.example.com,nope.example.com,nodots",
+			want: "good 127.0.0.1\n!yours\nnohost\nnotfqdn"},
+		{name: "no service", user: "alice", token: "secret", query: "hostname=disabled.example.com", want: "nohost"},
+	}
+	for _, tt := range tests {
+		*now = now.Add(tt.wait)
+		status, body := get(tt.user, tt.token, tt.query)
+		wantStatus := tt.wantStatus
+		if wantStatus == 0 {
+			wantStatus = http.StatusOK
+		}
+		if status != wantStatus || body != tt.want {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, status, body, wantStatus, tt.want)
+		}
+	}
+}
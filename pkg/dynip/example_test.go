@@ -0,0 +1,25 @@
+package dynip_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+func ExampleClient_Update() {
+	client := &dynip.Client{
+		Provider: &dynip.EasyDNS{},
+		Detector: &dynip.URLDetector{URL: "https://api.ipify.org"},
+	}
+	reply, err := client.Update(context.Background(), &dynip.Host{
+		Hostname: "office.example.com",
+		Username: "user",
+		Token:    "token",
+	})
+	if err != nil {
+		fmt.Println(reply.Result, err)
+		return
+	}
+	fmt.Println(reply.Result, reply.Plan.SentIP)
+}
@@ -0,0 +1,38 @@
+package dynip
+
+// DefaultMyIP is sent as the address when detection is left to the
+// provider; easyDNS then uses the address the request came from.
+const DefaultMyIP = "1.1.1.1"
+
+// Host holds the settings for updating one hostname.
+type Host struct {
+	Hostname string
+	Username string
+	Token    string
+
+	// Tld is the zone containing Hostname, needed when it is not the
+	// last two labels, e.g. "co.uk". Optional.
+	Tld string
+	// MyIP is sent when no address is detected. Defaults to DefaultMyIP.
+	MyIP string
+	// Mx is an optional mail exchanger for the hostname.
+	Mx string
+	// BackMx requests backup MX service, such as "YES". It is sent as is
+	// unless empty or "NO", "OFF" or "FALSE".
+	BackMx string
+	// Wildcard also points *.Hostname at the address, such as "ON". It
+	// is sent as is unless empty or "NO", "OFF" or "FALSE".
+	Wildcard string
+
+	// Offline means the record has been taken offline and must not be
+	// updated.
+	Offline bool
+}
+
+// myIP returns the address sent when no address is detected.
+func (h *Host) myIP() string {
+	if h.MyIP == "" {
+		return DefaultMyIP
+	}
+	return h.MyIP
+}
@@ -0,0 +1,59 @@
+package dynip
+
+import (
+	"net"
+)
+
+// Decision is the outcome of deciding whether to send an update.
+type Decision string
+
+const (
+	// DecisionUpdate means the update request is sent to the provider.
+	DecisionUpdate Decision = "update"
+	// DecisionUnchanged means the hostname already has the detected address.
+	DecisionUnchanged Decision = "unchanged"
+	// DecisionBlocked means the detected address is not allowed by policy.
+	DecisionBlocked Decision = "blocked"
+	// DecisionOffline means the host is offline and must not be updated.
+	DecisionOffline Decision = "offline"
+)
+
+// Plan describes what an update for a host would do.
+type Plan struct {
+	DetectedIP string // locally detected address; empty if detected by provider
+	SentIP     string // value sent as myip
+	Decision   Decision
+	Reason     string
+}
+
+// nonPublicNets are address ranges that are never published.
+var nonPublicNets = mustParseCIDRs(
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10",
+	"169.254.0.0/16", "127.0.0.0/8", "fc00::/7", "fe80::/10", "::1/128")
+
+// IsPublicIP returns true if ip is a global unicast address outside
+// the private, shared, link-local and loopback ranges.
+func IsPublicIP(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil || !ip.IsGlobalUnicast() {
+		return false
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	arr := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		arr = append(arr, n)
+	}
+	return arr
+}
@@ -0,0 +1,140 @@
+package dynip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Provider sends update requests to a dynamic DNS service.
+type Provider interface {
+	// Name identifies the provider, such as "easydns".
+	Name() string
+	// Update asks the provider to point the host at ip. The reply is
+	// never nil; its Result is LOCALERROR if no response was received.
+	Update(ctx context.Context, host *Host, ip string) (*Reply, error)
+}
+
+// Reply holds the details of a completed update request.
+type Reply struct {
+	Result  Result
+	Code    string // status code as sent by the server, such as "TOO_FREQ"
+	Message string // server message following the code, with markup removed
+	IP      string // IP address the server reports for the hostname, if any
+	Body    string // response body as received
+	Plan    *Plan  // set by Client.Update
+}
+
+// maxResponse is the most of a response body that is read.
+const maxResponse = 64 * 1024
+
+// DefaultEasyDNSURL is the easyDNS update API, without scheme.
+const DefaultEasyDNSURL = "api.cp.easydns.com/dyn/generic.php"
+
+// EasyDNS is the easyDNS dynamic DNS provider.
+type EasyDNS struct {
+	// URL is the host and path of the update API, without scheme.
+	// Defaults to DefaultEasyDNSURL.
+	URL string
+	// Proto is "https" (the default) or "http".
+	Proto string
+	// Client makes the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Name returns "easydns".
+func (p *EasyDNS) Name() string {
+	return "easydns"
+}
+
+// RequestURL returns the update request URL sending ip as the address.
+func (p *EasyDNS) RequestURL(host *Host, ip string) string {
+	var sb strings.Builder
+
+	proto := p.Proto
+	if proto == "" {
+		proto = "https"
+	}
+	u := p.URL
+	if u == "" {
+		u = DefaultEasyDNSURL
+	}
+	sb.WriteString(proto)
+	sb.WriteString("://")
+	sb.WriteString(host.Username)
+	sb.WriteString(":")
+	sb.WriteString(host.Token)
+	sb.WriteString("@")
+	sb.WriteString(u)
+	sb.WriteString("?")
+
+	param := func(name string, val string) {
+		sb.WriteString(name)
+		sb.WriteString("=")
+		sb.WriteString(val)
+		sb.WriteString("&")
+	}
+	param("hostname", host.Hostname)
+	if host.Tld != "" {
+		param("tld", host.Tld)
+	}
+	param("myip", ip)
+	if host.Mx != "" {
+		param("mx", host.Mx)
+	}
+	if isSet(host.BackMx) {
+		param("backmx", host.BackMx)
+	}
+	if isSet(host.Wildcard) {
+		param("wildcard", host.Wildcard)
+	}
+	return sb.String()
+}
+
+// isSet returns true if a flag such as backmx is to be sent.
+func isSet(s string) bool {
+	switch strings.ToUpper(s) {
+	case "", "NO", "OFF", "FALSE":
+		return false
+	}
+	return true
+}
+
+// Update sends the update request.
+func (p *EasyDNS) Update(ctx context.Context, host *Host, ip string) (*Reply, error) {
+	reply := &Reply{Result: LOCALERROR}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest("GET", p.RequestURL(host, ip), nil)
+	if err != nil {
+		return reply, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		if err = checkProxyError(err); IsProxyError(err) {
+			reply.Result = PROXYERROR
+		}
+		return reply, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := checkProxyResponse(resp); err != nil {
+		reply.Result = PROXYERROR
+		return reply, err
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return reply, err
+	}
+	reply = ParseResponse(string(body))
+	if !reply.Result.Success() {
+		return reply, fmt.Errorf("%v", reply.Result)
+	}
+	return reply, nil
+}
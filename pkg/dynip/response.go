@@ -0,0 +1,97 @@
+package dynip
+
+import (
+	"html"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// codeResults maps the status codes sent by easyDNS, in upper case, to
+// results. OK and NOERROR are refined to SUCCESS or NOCHANGE from the
+// message.
+var codeResults = map[string]Result{
+	"OK":            SUCCESS,
+	"NOERROR":       SUCCESS,
+	"NO_AUTH":       NOAUTH,
+	"NOACCESS":      NOAUTH,
+	"NOSERVICE":     NOSERVICE,
+	"NO_SERVICE":    NOSERVICE,
+	"ILLEGAL":       ILLEGALINPUT,
+	"ILLEGAL_INPUT": ILLEGALINPUT,
+	"TOOSOON":       TOOSOON,
+	"TOO_SOON":      TOOSOON,
+	"TOO_FREQ":      TOOSOON,
+	"NO_PARTNER":    NOPARTNER,
+	"NOPARTNER":     NOPARTNER,
+	"ERROR":         SERVERERROR,
+}
+
+var (
+	reTags     = regexp.MustCompile(`<[^>]*>`)
+	reUpdateIP = regexp.MustCompile(`(?i)\bto\s+([0-9a-f.:]+)`)
+)
+
+// ParseResponse parses an easyDNS response body. The body is split into
+// the text between markup; the status code is the first piece of text
+// that is exactly a known code, or failing that the first word of a plain
+// text body in upper case. The message is the text following the code. The result is
+// UNKNOWN if no code is found.
+func ParseResponse(body string) *Reply {
+	reply := &Reply{Body: body, Result: UNKNOWN}
+	nodes := textNodes(body)
+
+	idx := -1
+	for i, n := range nodes {
+		if _, ok := codeResults[strings.ToUpper(n)]; ok {
+			idx = i
+			break
+		}
+	}
+	switch {
+	case idx >= 0:
+		reply.Code = nodes[idx]
+		reply.Message = strings.Join(nodes[idx+1:], " ")
+	case len(nodes) > 0:
+		// codes are upper case, which avoids taking "ok" from a sentence
+		words := strings.Fields(nodes[0])
+		if word := strings.TrimRight(words[0], ":"); codeResults[word] != "" {
+			reply.Code = word
+			nodes[0] = strings.Join(words[1:], " ")
+		}
+		reply.Message = strings.TrimSpace(strings.Join(nodes, " "))
+	}
+
+	if reply.Code != "" {
+		reply.Result = codeResults[strings.ToUpper(reply.Code)]
+		if reply.Result == SUCCESS && !strings.Contains(strings.ToLower(reply.Message), "updated to") {
+			reply.Result = NOCHANGE
+		}
+	}
+	reply.IP = responseIP(reply.Message)
+	return reply
+}
+
+// textNodes returns the text between markup in s with entities decoded,
+// whitespace collapsed and empty pieces dropped.
+func textNodes(s string) []string {
+	var nodes []string
+	for _, n := range reTags.Split(s, -1) {
+		n = strings.Join(strings.Fields(html.UnescapeString(n)), " ")
+		if n != "" {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// responseIP returns the IP address found in a server message such as
+// "host updated to 1.2.3.4", or empty string if none.
+func responseIP(msg string) string {
+	for _, m := range reUpdateIP.FindAllStringSubmatch(msg, -1) {
+		if ip := net.ParseIP(strings.TrimRight(m[1], ".")); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+//go:build go1.18
+// +build go1.18
+
+package dynip
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func FuzzParseResponse(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "responses", "*"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(body))
+	}
+
+	f.Fuzz(func(t *testing.T, body string) {
+		reply := ParseResponse(body)
+		if _, ok := exitCodes[reply.Result]; !ok {
+			t.Fatalf("result %q is not a known result", reply.Result)
+		}
+		if (reply.Code == "") != (reply.Result == UNKNOWN) {
+			t.Fatalf("code %q with result %v", reply.Code, reply.Result)
+		}
+		if reply.IP != "" && net.ParseIP(reply.IP) == nil {
+			t.Fatalf("ip %q is not an IP address", reply.IP)
+		}
+		if reply.Message != strings.Join(strings.Fields(reply.Message), " ") {
+			t.Fatalf("message %q has untidy whitespace", reply.Message)
+		}
+		if reply.Body != body {
+			t.Fatal("body not kept")
+		}
+	})
+}
+
+func FuzzResponseIP(f *testing.F) {
+	f.Add("host updated to 1.2.3.4.")
+	f.Add("no update required for host to 2001:db8::1")
+	f.Add("to 600 seconds")
+	f.Fuzz(func(t *testing.T, msg string) {
+		ip := responseIP(msg)
+		if ip != "" && net.ParseIP(ip) == nil {
+			t.Fatalf("responseIP(%q) = %q, not an IP address", msg, ip)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package dynip
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		file    string
+		want    Result
+		code    string
+		message string
+		ip      string
+	}{
+		{file: "ok-updated.html", want: SUCCESS, code: "OK",
+			message: "test.example.com updated to 24.114.104.44", ip: "24.114.104.44"},
+		{file: "ok-unchanged.html", want: NOCHANGE, code: "OK",
+			message: "no update required for aspen.darklake.ca to 24.114.85.179", ip: "24.114.85.179"},
+		{file: "noerror-updated.html", want: SUCCESS, code: "NOERROR",
+			message: "office.example.co.uk updated to 2001:db8:85a3::8a2e:370:7334.", ip: "2001:db8:85a3::8a2e:370:7334"},
+		{file: "plain-noerror.txt", want: SUCCESS, code: "NOERROR",
+			message: "test.example.com updated to 198.51.100.20", ip: "198.51.100.20"},
+		{file: "too-freq.html", want: TOOSOON, code: "TOO_FREQ",
+			message: "Increase your time between updates for test.example.com to 600 seconds or more."},
+		{file: "no-auth.html", want: NOAUTH, code: "NO_AUTH",
+			message: "Failed login attempt logged: user dlauder77, host test.example.com, from 24.114.82.202"},
+		{file: "no-service.html", want: NOSERVICE, code: "NO_SERVICE",
+			message: "Dynamic DNS is not enabled for test.example.com"},
+		{file: "illegal-input.html", want: ILLEGALINPUT, code: "ILLEGAL_INPUT",
+			message: "Illegal input: hostname 'test..example.com', myip '1.2.3'"},
+		{file: "error.html", want: SERVERERROR, code: "ERROR",
+			message: "An internal error occurred — please try again later."},
+		{file: "gateway-timeout.html", want: UNKNOWN,
+			message: "504 Gateway Time-out 504 Gateway Time-out nginx"},
+	}
+	for _, tt := range tests {
+		body, err := ioutil.ReadFile(filepath.Join("testdata", "responses", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply := ParseResponse(string(body))
+		if reply.Result != tt.want || reply.Code != tt.code || reply.IP != tt.ip {
+			t.Errorf("%s: result %v, code %q, ip %q; want %v, %q, %q", tt.file, reply.Result, reply.Code, reply.IP, tt.want, tt.code, tt.ip)
+		}
+		if reply.Message != tt.message {
+			t.Errorf("%s: message %q, want %q", tt.file, reply.Message, tt.message)
+		}
+		if reply.Body != string(body) {
+			t.Errorf("%s: body not kept", tt.file)
+		}
+	}
+}
+
+func TestParseResponseEdgeCases(t *testing.T) {
+	tests := []struct {
+		body string
+		want Result
+		code string
+	}{
+		{body: "", want: UNKNOWN},
+		{body: "<b></b>", want: UNKNOWN},
+		{body: "ok, we will look into it", want: UNKNOWN},
+		{body: "<p>ok</p><p>no update required</p>", want: NOCHANGE, code: "ok"},
+		{body: "TOO_FREQ: slow down", want: TOOSOON, code: "TOO_FREQ"},
+		{body: "<p>unclosed <b", want: UNKNOWN},
+		{body: "<p>Please note</p><p>NOACCESS</p>", want: NOAUTH, code: "NOACCESS"},
+	}
+	for _, tt := range tests {
+		reply := ParseResponse(tt.body)
+		if reply.Result != tt.want || reply.Code != tt.code {
+			t.Errorf("ParseResponse(%q) = %v %q, want %v %q", tt.body, reply.Result, reply.Code, tt.want, tt.code)
+		}
+	}
+}
+
+func Test_responseIP(t *testing.T) {
+	tests := map[string]string{
+		"host updated to 1.2.3.4":          "1.2.3.4",
+		"host updated to 1.2.3.4.":         "1.2.3.4",
+		"host updated TO   ::ffff:1.2.3.4": "1.2.3.4",
+		"wait to 600 seconds":              "",
+		"host updated to 1.2.3":            "",
+		"to 999.1.1.1 then to 5.6.7.8":     "5.6.7.8",
+	}
+	for msg, want := range tests {
+		if got := responseIP(msg); got != want {
+			t.Errorf("responseIP(%q) = %q, want %q", msg, got, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package dynip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Result represents the result code returned from an IP update request.
+type Result string
+
+const (
+	// SUCCESS means the IP address updated successfully
+	SUCCESS Result = "SUCCESS"
+	// NOCHANGE means IP address is already the requested value
+	NOCHANGE Result = "NO_CHANGE"
+	// NOAUTH means password/token incorrect
+	NOAUTH Result = "NO_AUTH"
+	// NOSERVICE means Dynamic DNS is not turned on for this domain
+	NOSERVICE Result = "NO_SERVICE"
+	// ILLEGALINPUT means a request param was invalid
+	ILLEGALINPUT Result = "ILLEGAL_INPUT"
+	// TOOSOON means the request was issued before minimum interval elapsed
+	TOOSOON Result = "TOO_SOON"
+	// NOPARTNER means the request did not include required partner information
+	// or there was an error detecting the partner.
+	NOPARTNER Result = "NO_PARTNER"
+	// SERVERERROR means a generic error occurred on the server
+	SERVERERROR Result = "SERVER_ERROR"
+	// BLOCKED means the update was not sent because the detected IP address
+	// is not allowed by policy
+	BLOCKED Result = "BLOCKED"
+	// UNKNOWN means the response contained none of the known result codes
+	UNKNOWN Result = "UNKNOWN_RESPONSE"
+	// LOCALERROR means there was a local error
+	LOCALERROR Result = "LOCAL_ERROR"
+	// PROXYERROR means the request failed connecting to or through a proxy
+	PROXYERROR Result = "PROXY_ERROR"
+)
+
+// exitCodes maps each Result to the process exit code returned for a
+// one-shot update. Both successful results exit with zero.
+var exitCodes = map[Result]int{
+	SUCCESS:      0,
+	NOCHANGE:     0,
+	NOAUTH:       10,
+	NOSERVICE:    11,
+	ILLEGALINPUT: 12,
+	TOOSOON:      13,
+	NOPARTNER:    14,
+	SERVERERROR:  15,
+	UNKNOWN:      16,
+	LOCALERROR:   17,
+	BLOCKED:      18,
+	PROXYERROR:   19,
+}
+
+// ExitCode returns the process exit code for the result.
+func (r Result) ExitCode() int {
+	if code, ok := exitCodes[r]; ok {
+		return code
+	}
+	return exitCodes[UNKNOWN]
+}
+
+// Success returns true if the hostname has the requested address.
+func (r Result) Success() bool {
+	return r == SUCCESS || r == NOCHANGE
+}
+
+// ProxyError is a failure connecting to or through a proxy, as opposed to
+// a failure reported by the provider.
+type ProxyError struct {
+	Err error
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("proxy error: %v", e.Err)
+}
+
+// IsProxyError returns true if err is a *ProxyError.
+func IsProxyError(err error) bool {
+	_, ok := err.(*ProxyError)
+	return ok
+}
+
+// checkProxyError returns err as a *ProxyError if it is a failure to
+// connect to or through a proxy, otherwise err unchanged.
+func checkProxyError(err error) error {
+	e := err
+	if ue, ok := e.(*url.Error); ok {
+		e = ue.Err
+	}
+	if oe, ok := e.(*net.OpError); ok && oe.Op == "proxyconnect" {
+		return &ProxyError{Err: oe.Err}
+	}
+	return err
+}
+
+// checkProxyResponse returns a *ProxyError if the response came from a
+// proxy refusing the request rather than from the server.
+func checkProxyResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return &ProxyError{Err: fmt.Errorf("%s", resp.Status)}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package dynip
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// State reports the addresses a hostname currently has, so that updates
+// which would change nothing are skipped.
+type State interface {
+	// Lookup returns the current addresses of the hostname.
+	Lookup(ctx context.Context, hostname string) ([]string, error)
+	// Store records that the hostname now has the address.
+	Store(hostname string, ip string)
+}
+
+// DNSState looks up the current addresses in DNS. Store does nothing;
+// DNS catches up by itself.
+type DNSState struct {
+	// Resolver is used for lookups. Defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+// Lookup resolves the hostname.
+func (s *DNSState) Lookup(ctx context.Context, hostname string) ([]string, error) {
+	r := s.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	return r.LookupHost(ctx, hostname)
+}
+
+// Store does nothing.
+func (s *DNSState) Store(hostname string, ip string) {}
+
+// MemoryState remembers the last address stored for each hostname.
+// The zero value is ready to use.
+type MemoryState struct {
+	mux   sync.Mutex
+	addrs map[string]string
+}
+
+// Lookup returns the address last stored for the hostname, if any.
+func (s *MemoryState) Lookup(ctx context.Context, hostname string) ([]string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if ip, ok := s.addrs[hostname]; ok {
+		return []string{ip}, nil
+	}
+	return nil, nil
+}
+
+// Store remembers the address for the hostname.
+func (s *MemoryState) Store(hostname string, ip string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.addrs == nil {
+		s.addrs = make(map[string]string)
+	}
+	s.addrs[hostname] = ip
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+// lookupHost resolves a hostname; replaced in tests.
+var lookupHost = net.DefaultResolver.LookupHost
+
+// lookupState reports the current addresses of a hostname using lookupHost.
+type lookupState struct{}
+
+func (lookupState) Lookup(ctx context.Context, hostname string) ([]string, error) {
+	return lookupHost(ctx, hostname)
+}
+
+func (lookupState) Store(hostname string, ip string) {}
+
+// makePlan detects the IP address (if configured to do so) and decides
+// whether an update should be sent. The provider is not contacted.
+func makePlan(ctx context.Context, appConfig *AppConfig) (*dynip.Plan, error) {
+	plan, err := newClient(appConfig).Plan(ctx, newHost(appConfig))
+	if err != nil {
+		return nil, err
+	}
+	if plan.Decision == dynip.DecisionOffline {
+		plan.Reason = fmt.Sprintf("%s is offline; run `dynip online` to resume updates", appConfig.getKeyVal(keyHostname))
+	}
+	return plan, nil
+}
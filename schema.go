@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// schemaID is the published location of the config schema.
+const schemaID = "https://raw.githubusercontent.com/wiggin77/dynip/master/dynip.schema.json"
+
+// keySchema returns the JSON Schema for the value of a config key.
+func keySchema(k configKey) map[string]interface{} {
+	s := map[string]interface{}{"type": "string"}
+	switch k.typ {
+	case TYPEHOST:
+		s["format"] = "hostname"
+	case TYPEIP:
+		s["anyOf"] = []interface{}{
+			map[string]interface{}{"format": "ipv4"},
+			map[string]interface{}{"format": "ipv6"},
+		}
+	case TYPEBOOL:
+		s["type"] = []string{"string", "boolean"}
+		s["pattern"] = "^([Yy][Ee][Ss]|[Nn][Oo]|[Oo][Nn]|[Oo][Ff][Ff]|[Tt][Rr][Uu][Ee]|[Ff][Aa][Ll][Ss][Ee])$"
+	case TYPEDURATION:
+		s["pattern"] = `^\s*[0-9.]+\s*[a-zA-Z]*\s*$`
+	case TYPESIZE:
+		s["type"] = []string{"string", "integer"}
+		s["pattern"] = `^\s*[0-9]+\s*([KkMmGg]?[Bb])?\s*$`
+	case TYPEPROTO:
+		s["enum"] = []string{"http", "https"}
+	case TYPEDETECT:
+		s["enum"] = []string{detectServer, detectURL, detectInterface}
+	case TYPEURL:
+		s["format"] = "uri"
+	case TYPEINT:
+		s["type"] = []string{"string", "integer"}
+		s["pattern"] = `^[1-9][0-9]*$`
+	case TYPEMAINTMODE:
+		s["enum"] = []string{maintSuspend, maintOffline}
+	case TYPETLSVERSION:
+		s["enum"] = tlsVersionNames()
+	case TYPEFACILITY:
+		s["enum"] = syslogFacilityNames()
+	case TYPESYSLOGFORMAT:
+		s["enum"] = []string{syslogRFC3164, syslogRFC5424}
+	case TYPESYSLOGADDR:
+		s["pattern"] = "^([Uu][Dd][Pp]|[Tt][Cc][Pp]|[Tt][Ll][Ss])://"
+	case TYPELOGFORMAT:
+		s["enum"] = []string{logFormatText, logFormatJSON, logFormatLogfmt}
+	}
+	if k.def != "" {
+		s["default"] = k.def
+	}
+	return s
+}
+
+// configSchema returns a JSON Schema describing YAML, TOML and JSON
+// config files. Host sections may be given either as tables named after
+// the host or as a "hosts" list of tables with a "name".
+func configSchema() map[string]interface{} {
+	props := make(map[string]interface{})
+	hostProps := make(map[string]interface{})
+	for _, k := range keysAll {
+		props[k.name] = keySchema(k)
+		if !k.global {
+			hostProps[k.name] = keySchema(k)
+		}
+	}
+	host := map[string]interface{}{
+		"type":                 "object",
+		"properties":           hostProps,
+		"additionalProperties": false,
+	}
+	namedProps := make(map[string]interface{}, len(hostProps)+1)
+	for k, v := range hostProps {
+		namedProps[k] = v
+	}
+	namedProps["name"] = map[string]interface{}{"type": "string", "pattern": `^[^.]+$`}
+	props["hosts"] = map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type":                 "object",
+			"properties":           namedProps,
+			"required":             []string{"name"},
+			"additionalProperties": false,
+		},
+	}
+	return map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"$id":                  schemaID,
+		"title":                "dynip configuration",
+		"type":                 "object",
+		"properties":           props,
+		"patternProperties":    map[string]interface{}{sectionPattern(): host},
+		"additionalProperties": false,
+	}
+}
+
+// sectionPattern returns a pattern matching host section names, which are
+// any names other than those of the top level keys.
+func sectionPattern() string {
+	names := make([]string, 0, len(keysAll)+1)
+	for _, k := range keysAll {
+		names = append(names, k.name)
+	}
+	names = append(names, "hosts")
+	return "^(?!(" + strings.Join(names, "|") + ")$)[^.]+$"
+}
+
+// writeSchema outputs the config schema as indented JSON.
+func writeSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(configSchema())
+}
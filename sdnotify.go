@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sdNotifier sends state notifications to systemd, as sd_notify(3) does,
+// when the service is started with Type=notify. Without NOTIFY_SOCKET it
+// does nothing.
+type sdNotifier struct {
+	socket   string
+	watchdog time.Duration // interval systemd expects pings within; zero if disabled
+}
+
+// newSDNotifier returns a notifier for the NOTIFY_SOCKET, WATCHDOG_USEC and
+// WATCHDOG_PID environment variables set by systemd.
+func newSDNotifier() *sdNotifier {
+	sn := &sdNotifier{socket: os.Getenv("NOTIFY_SOCKET")}
+	if sn.socket == "" {
+		return sn
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return sn
+	}
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		sn.watchdog = time.Duration(usec) * time.Microsecond
+	}
+	return sn
+}
+
+// notify sends the state assignments, such as "READY=1", in one message.
+func (sn *sdNotifier) notify(state ...string) error {
+	if sn == nil || sn.socket == "" {
+		return nil
+	}
+	socket := sn.socket
+	if strings.HasPrefix(socket, "@") {
+		// abstract namespace
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	_, err = conn.Write([]byte(strings.Join(state, "\n")))
+	return err
+}
+
+// ready tells systemd the service has started.
+func (sn *sdNotifier) ready(status string) error {
+	return sn.notify("READY=1", "STATUS="+status)
+}
+
+// status sets the status shown by `systemctl status`.
+func (sn *sdNotifier) status(status string) error {
+	return sn.notify("STATUS=" + status)
+}
+
+// ping tells the systemd watchdog the daemon loop is alive.
+func (sn *sdNotifier) ping() error {
+	return sn.notify("WATCHDOG=1")
+}
+
+// stopping tells systemd the service is stopping.
+func (sn *sdNotifier) stopping() error {
+	return sn.notify("STOPPING=1", "STATUS=Stopping")
+}
+
+// pingInterval returns how often to ping the watchdog: half its timeout,
+// as sd_watchdog_enabled(3) recommends. Zero if the watchdog is disabled.
+func (sn *sdNotifier) pingInterval() time.Duration {
+	if sn == nil {
+		return 0
+	}
+	return sn.watchdog / 2
+}
+
+// watchdogTimeout is the WatchdogSec of a generated unit. The daemon pings
+// after each host, so it need only allow for one host's secret, detect and
+// update timeouts; it does not depend on the config so hosts and timeouts
+// can change without reinstalling. Notify commands run in the background
+// so do not count.
+const watchdogTimeout = time.Minute * 15
+
+// writablePaths returns the directories the service writes to: those of
+// the config file (for the offline list and history journal), the log
+// file and the history journal.
+func writablePaths(appConfig *AppConfig, configFile string) []string {
+	dirs := map[string]bool{}
+	if abs, err := filepath.Abs(configFile); err == nil {
+		dirs[filepath.Dir(abs)] = true
+	}
+	if file := appConfig.getKeyVal(keyLogFile); file != "" && !isStdLog(file) {
+		if abs, err := filepath.Abs(file); err == nil {
+			dirs[filepath.Dir(abs)] = true
+		}
+	}
+	if file := appConfig.historyPath(); file != "" {
+		if abs, err := filepath.Abs(file); err == nil {
+			dirs[filepath.Dir(abs)] = true
+		}
+	}
+	paths := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		paths = append(paths, dir)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// systemdUnit returns the systemd unit template used when installing the
+// service: Type=notify with a watchdog, reopening the log on reload, the
+// -env variables from envFile if not empty, and sandboxing that leaves
+// only writablePaths writable. It is a template for kardianos/service,
+// which fills in the command line and user.
+func systemdUnit(watchdog time.Duration, writable []string, envFile string) string {
+	quoted := make([]string, len(writable))
+	for i, p := range writable {
+		quoted[i] = strconv.Quote(p)
+	}
+	if envFile != "" {
+		envFile = "EnvironmentFile=" + envFile + "\n"
+	}
+	return `[Unit]
+Description={{.Description}}
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+After=network-online.target
+Wants=network-online.target
+{{range .Dependencies}}After={{.}}
+Requires={{.}}
+{{end}}
+[Service]
+Type=notify
+NotifyAccess=main
+WatchdogSec=` + strconv.Itoa(int(watchdog.Seconds())) + `
+StartLimitInterval=5
+StartLimitBurst=10
+ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
+ExecReload=/bin/kill -HUP "$MAINPID"
+{{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory|cmdEscape}}{{end}}
+{{if .UserName}}User={{.UserName}}{{end}}
+Restart=always
+RestartSec=120
+EnvironmentFile=-/etc/sysconfig/{{.Name}}
+` + envFile + `
+NoNewPrivileges=yes
+ProtectSystem=strict
+ProtectHome=read-only
+ReadWritePaths=` + strings.Join(quoted, " ") + `
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectControlGroups=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6 AF_NETLINK
+RestrictNamespaces=yes
+RestrictRealtime=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+
+[Install]
+WantedBy=multi-user.target
+`
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+// listenNotify listens on a unixgram socket as systemd would and points
+// NOTIFY_SOCKET at it. The returned function restores the environment.
+func listenNotify(t *testing.T, watchdogUsec string) (*net.UnixConn, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unixgram sockets")
+	}
+	dir := makeTempDir(t)
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	env := map[string]string{"NOTIFY_SOCKET": socket, "WATCHDOG_USEC": watchdogUsec, "WATCHDOG_PID": ""}
+	old := make(map[string]string)
+	for k, v := range env {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, v)
+	}
+	return conn, func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// readNotify returns the next notification, failing the test on timeout.
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func Test_sdNotifier(t *testing.T) {
+	conn, restore := listenNotify(t, "3000000")
+	defer restore()
+
+	sn := newSDNotifier()
+	if sn.pingInterval() != time.Millisecond*1500 {
+		t.Errorf("pingInterval() = %v, want 1.5s", sn.pingInterval())
+	}
+	if err := sn.ready("Waiting for first update"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, conn); got != "READY=1\nSTATUS=Waiting for first update" {
+		t.Errorf("ready = %q", got)
+	}
+	if err := sn.stopping(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, conn); got != "STOPPING=1\nSTATUS=Stopping" {
+		t.Errorf("stopping = %q", got)
+	}
+
+	// the watchdog is for another process
+	os.Setenv("WATCHDOG_PID", "1")
+	if sn := newSDNotifier(); sn.pingInterval() != 0 {
+		t.Errorf("pingInterval() = %v for another process's watchdog, want 0", sn.pingInterval())
+	}
+
+	// not started by systemd
+	os.Setenv("NOTIFY_SOCKET", "")
+	var none *sdNotifier
+	if err := newSDNotifier().ready("x"); err != nil || none.ping() != nil {
+		t.Errorf("notify without NOTIFY_SOCKET = %v, want nil", err)
+	}
+}
+
+func Test_daemonSDNotify(t *testing.T) {
+	conn, restore := listenNotify(t, "60000000")
+	defer restore()
+
+	update := func(ctx context.Context, appConfig *AppConfig, logger *logrus.Logger) (*dynip.Reply, error) {
+		return &dynip.Reply{Result: dynip.SUCCESS, IP: "203.0.113.5"}, nil
+	}
+	do := makeDaemonTestOpt(t, "20 minutes", update)
+	do.notifier = newSDNotifier()
+	fc := do.clock.(*fakeClock)
+
+	done := make(chan struct{})
+	go func() {
+		runDaemon(do)
+		close(done)
+	}()
+	defer func() {
+		close(do.exit)
+		<-done
+	}()
+
+	if got := readNotify(t, conn); got != "WATCHDOG=1" {
+		t.Errorf("first notification = %q, want WATCHDOG=1", got)
+	}
+	fc.advance()
+	if got := readNotify(t, conn); !strings.HasPrefix(got, "STATUS=test.example.com: SUCCESS 203.0.113.5 at ") {
+		t.Errorf("status = %q", got)
+	}
+	if got := readNotify(t, conn); got != "WATCHDOG=1" {
+		t.Errorf("notification after the host = %q, want WATCHDOG=1", got)
+	}
+
+	fc.mu.Lock()
+	pings := fc.tickers[1]
+	fc.mu.Unlock()
+	if pings.d != time.Second*30 {
+		t.Errorf("ping interval = %v, want 30s", pings.d)
+	}
+	pings.c <- time.Now()
+	if got := readNotify(t, conn); got != "WATCHDOG=1" {
+		t.Errorf("ping = %q, want WATCHDOG=1", got)
+	}
+}
+
+func Test_systemdUnit(t *testing.T) {
+	appConfig, err := NewAppConfigFromMap(map[string]string{
+		"hostname": "test.example.com",
+		"username": "testuser",
+		"token":    "testtoken",
+		"log":      "/var/log/dynip/dynip.log",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writable := writablePaths(appConfig, "/etc/dynip/dynip.conf")
+	if strings.Join(writable, " ") != "/etc/dynip /var/log/dynip" {
+		t.Errorf("writablePaths() = %v", writable)
+	}
+
+	// kardianos/service fills in the template with its own escaping funcs
+	funcs := template.FuncMap{"cmd": func(s string) string { return s }, "cmdEscape": func(s string) string { return s }}
+	tmpl, err := template.New("").Funcs(funcs).Parse(systemdUnit(watchdogTimeout, writable, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	err = tmpl.Execute(&sb, map[string]interface{}{
+		"Name": "dynip", "Description": "Dynamic IP update service", "Path": "/usr/local/bin/dynip",
+		"Arguments": []string{"-d", "-f", "/etc/dynip/dynip.conf"}, "WorkingDirectory": "", "UserName": "dynip",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit := sb.String()
+	for _, want := range []string{
+		"Type=notify\n",
+		"WatchdogSec=900\n",
+		"ExecStart=/usr/local/bin/dynip -d -f /etc/dynip/dynip.conf\n",
+		"User=dynip\n",
+		`ReadWritePaths="/etc/dynip" "/var/log/dynip"` + "\n",
+		"ProtectSystem=strict\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+}
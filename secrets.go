@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretResolver fetches the value of a secret key from outside the config,
+// such as a file, a password manager command or an HTTP secret store.
+type secretResolver interface {
+	// Resolve returns the secret value, giving up when ctx is done.
+	Resolve(ctx context.Context) (string, error)
+	// Invalidate discards any cached value so the next Resolve fetches it
+	// again, e.g. after the provider rejects the secret.
+	Invalidate()
+}
+
+// newSecretResolver creates the resolver for a secret variant key such as
+// token_command, configured with val.
+func newSecretResolver(variant configKey, val string, ttl time.Duration) secretResolver {
+	switch {
+	case strings.HasSuffix(variant.name, "_command"):
+		return newCachedResolver(&commandResolver{command: val}, ttl)
+	case strings.HasSuffix(variant.name, "_vault_url"):
+		return newCachedResolver(newVaultResolver(val), ttl)
+	default:
+		return fileResolver(val)
+	}
+}
+
+// fileResolver reads a secret from a file each time it is resolved.
+type fileResolver string
+
+func (file fileResolver) Resolve(ctx context.Context) (string, error) {
+	return readSecretFile(string(file))
+}
+func (file fileResolver) Invalidate() {}
+
+// cachedResolver caches the value from another resolver for a time-to-live.
+type cachedResolver struct {
+	mutex   sync.Mutex
+	res     secretResolver
+	ttl     time.Duration
+	now     func() time.Time
+	val     string
+	expires time.Time
+}
+
+func newCachedResolver(res secretResolver, ttl time.Duration) *cachedResolver {
+	return &cachedResolver{res: res, ttl: ttl, now: time.Now}
+}
+
+// Resolve returns the cached value, fetching a new one if it has expired.
+func (cr *cachedResolver) Resolve(ctx context.Context) (string, error) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	now := cr.now()
+	if cr.val != "" && now.Before(cr.expires) {
+		return cr.val, nil
+	}
+	val, err := cr.res.Resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	cr.val = val
+	cr.expires = now.Add(cr.ttl)
+	return val, nil
+}
+
+// Invalidate discards the cached value.
+func (cr *cachedResolver) Invalidate() {
+	cr.mutex.Lock()
+	cr.val = ""
+	cr.mutex.Unlock()
+	cr.res.Invalidate()
+}
+
+// commandResolver runs a command, such as a password manager CLI, and uses
+// its output as the secret.
+type commandResolver struct {
+	command string
+}
+
+func (cmdr *commandResolver) Resolve(ctx context.Context) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", cmdr.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", cmdr.command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("secret command: %v: %s", err, msg)
+		}
+		return "", fmt.Errorf("secret command: %v", err)
+	}
+	secret := strings.TrimSpace(string(out))
+	if secret == "" {
+		return "", fmt.Errorf("secret command produced no output")
+	}
+	return secret, nil
+}
+
+func (cmdr *commandResolver) Invalidate() {}
+
+// vaultResolver reads a secret from a HashiCorp Vault compatible KV store.
+// The URL fragment names the field to read; it defaults to "token".
+// The Vault token is taken from the VAULT_TOKEN environment variable.
+type vaultResolver struct {
+	url   string
+	field string
+}
+
+func newVaultResolver(s string) *vaultResolver {
+	vr := &vaultResolver{url: s, field: "token"}
+	if u, err := url.Parse(s); err == nil && u.Fragment != "" {
+		vr.field = u.Fragment
+		u.Fragment = ""
+		vr.url = u.String()
+	}
+	return vr
+}
+
+func (vr *vaultResolver) Resolve(ctx context.Context) (string, error) {
+	req, err := http.NewRequest("GET", vr.url, nil)
+	if err != nil {
+		return "", fmt.Errorf("vault: %v", err)
+	}
+	req = req.WithContext(ctx)
+	if tok := os.Getenv("VAULT_TOKEN"); tok != "" {
+		req.Header.Set("X-Vault-Token", tok)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", fmt.Errorf("vault: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: %s returned %s", vr.url, resp.Status)
+	}
+
+	// KV version 2 nests the secret in data.data; version 1 uses data.
+	var doc struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", fmt.Errorf("vault: %v", err)
+	}
+	data := doc.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	val, ok := data[vr.field].(string)
+	if !ok || val == "" {
+		return "", fmt.Errorf("vault: field '%s' not found at %s", vr.field, vr.url)
+	}
+	return val, nil
+}
+
+func (vr *vaultResolver) Invalidate() {}
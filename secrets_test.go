@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/cfg"
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+type countingResolver struct {
+	calls int
+}
+
+func (cr *countingResolver) Resolve(ctx context.Context) (string, error) {
+	cr.calls++
+	return fmt.Sprintf("secret%d", cr.calls), nil
+}
+
+func (cr *countingResolver) Invalidate() {}
+
+func Test_cachedResolver(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	counter := &countingResolver{}
+	cr := newCachedResolver(counter, time.Hour)
+	cr.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance    time.Duration
+		invalidate bool
+		want       string
+	}{
+		{want: "secret1"},
+		{advance: time.Minute * 59, want: "secret1"},
+		{advance: time.Minute, want: "secret2"},
+		{invalidate: true, want: "secret3"},
+		{advance: time.Minute, want: "secret3"},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		if step.invalidate {
+			cr.Invalidate()
+		}
+		got, err := cr.Resolve(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != step.want {
+			t.Errorf("step %d: Resolve() = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func Test_vaultResolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/dynip":
+			_, _ = fmt.Fprint(w, `{"data":{"data":{"token":"kv2token","other":"kv2other"},"metadata":{"version":3}}}`)
+		case "/v1/kv/dynip":
+			_, _ = fmt.Fprint(w, `{"data":{"token":"kv1token"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	os.Setenv("VAULT_TOKEN", "vault-token")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{name: "kv2", url: ts.URL + "/v1/secret/data/dynip", want: "kv2token"},
+		{name: "kv2 field", url: ts.URL + "/v1/secret/data/dynip#other", want: "kv2other"},
+		{name: "kv1", url: ts.URL + "/v1/kv/dynip", want: "kv1token"},
+		{name: "missing field", url: ts.URL + "/v1/kv/dynip#nope", wantErr: true},
+		{name: "not found", url: ts.URL + "/v1/kv/other", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newVaultResolver(tt.url).Resolve(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sendUpdateRefetchOnNoAuth(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses /bin/sh")
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pw, _ := r.BasicAuth(); pw == "newtoken" {
+			_, _ = fmt.Fprintln(w, respSUCCESS)
+			return
+		}
+		_, _ = fmt.Fprintln(w, respBADTOKEN)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("oldtoken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	appConfig, err := makeTestConfig(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appConfig.PrependSource(cfg.NewSrcMapFromMap(map[string]string{"token": "", "token_command": "cat " + secret}))
+	if got := appConfig.getKeyVal(keyToken); got != "oldtoken" {
+		t.Fatalf("token = %v, want oldtoken", got)
+	}
+
+	// rotate the token; the cached value is now stale
+	if err := ioutil.WriteFile(secret, []byte("newtoken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tlog := logrus.New()
+	tlog.Out = ioutil.Discard
+	reply, err := sendUpdate(context.Background(), appConfig, tlog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Result != dynip.SUCCESS {
+		t.Errorf("result = %v, want %v", reply.Result, dynip.SUCCESS)
+	}
+}
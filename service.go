@@ -1,10 +1,10 @@
 package main
 
 import (
-	"flag"
-	"io"
+	"context"
+	"fmt"
 	"log"
-	"os"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -12,8 +12,12 @@ import (
 )
 
 type program struct {
-	exit   chan string
-	logger *logrus.Logger
+	exit      chan string
+	done      chan struct{} // closed when the daemon loop returns
+	logger    *logrus.Logger
+	appConfig *AppConfig
+	notifier  *sdNotifier
+	opts      *cliOpts
 }
 
 // Start is called by service manager to start the service. Don't block.
@@ -26,19 +30,11 @@ func (p *program) Start(s service.Service) error {
 
 	p.exit = make(chan string, 2)
 
-	// get config file name
-	var file string
-	var daemon bool
-	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-	fs.StringVar(&file, "f", defConfigFile(), "config file")
-	fs.BoolVar(&daemon, "d", false, "run as a daemon")
-	err := fs.Parse(os.Args[1:])
-	if err != nil {
-		return err
-	}
+	file := p.opts.file
+	format := p.opts.format
 
 	// load config file
-	appConfig, err := NewAppConfig(file)
+	appConfig, err := p.opts.loadConfig()
 	if err != nil {
 		return err
 	}
@@ -49,24 +45,77 @@ func (p *program) Start(s service.Service) error {
 		return err
 	}
 
-	do := &daemonOpt{appConfig: appConfig, logger: p.logger, exit: p.exit}
-	go runDaemon(do)
+	// strictly validate the config file
+	probs, err := checkConfigFile(file, format)
+	if err != nil {
+		return err
+	}
+	for _, prob := range probs {
+		if prob.sev == WARNING {
+			p.logger.Warn(prob)
+		} else {
+			p.logger.Error(prob)
+		}
+	}
+	if probs.hasErrors() {
+		return fmt.Errorf("config file %s has errors; run `dynip config check` for details", file)
+	}
+
+	// with offline_on_stop the records were set offline when last stopped,
+	// so update straight away to bring them back online
+	p.appConfig = appConfig
+	offlineOnStop := isTrue(appConfig.getKeyVal(keyOfflineOnStop))
 
+	p.notifier = newSDNotifier()
+	do := &daemonOpt{appConfig: appConfig, logger: p.logger, exit: p.exit, updateOnStart: offlineOnStop,
+		notifier: p.notifier}
+	p.done = make(chan struct{})
+	go signalMon(p.exit)
+	go reopenOnHangup(p.logger, p.done)
+	go func() {
+		defer close(p.done)
+		runDaemon(do)
+	}()
+
+	if err := p.notifier.ready("Waiting for first update"); err != nil {
+		p.logger.WithField("err", err).Warn("systemd notification failed")
+	}
 	return nil
 }
 
 // Stop is called by service manager to stop the service. Don't block for more
 // than a few seconds.
 func (p *program) Stop(s service.Service) error {
+	// Stop should not block. Return within stop_timeout, which covers both
+	// cancelling work in progress and offline_on_stop.
+	_ = p.notifier.stopping()
+	p.exit <- "service controller issued Stop command"
+	close(p.exit)
+
+	timeout := time.Second * 10
+	if p.appConfig != nil {
+		timeout = p.appConfig.timeout(keyStopTimeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if p.done != nil {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			if p.logger != nil {
+				p.logger.Errorf("daemon did not stop within %v", timeout)
+			}
+		}
+	}
+
+	if p.appConfig != nil && p.logger != nil && isTrue(p.appConfig.getKeyVal(keyOfflineOnStop)) {
+		setHostsOffline(ctx, p.appConfig, p.logger)
+	}
+
 	// close the log file (if any)
 	if p.logger != nil {
-		c, ok := p.logger.Out.(io.Closer)
-		if ok {
-			_ = c.Close()
-		}
+		closeLog(p.logger)
 	}
-	// Stop should not block. Return within a few seconds.
-	p.exit <- "service controller issued Stop command"
-	close(p.exit)
 	return nil
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// envPrefix is prepended to upper case key names to form environment
+// variable names, e.g. DYNIP_TOKEN or DYNIP_TOKEN_FILE.
+const envPrefix = "DYNIP_"
+
+// srcEnv is a config Source backed by DYNIP_* environment variables.
+type srcEnv struct {
+	lookup func(string) (string, bool)
+}
+
+// newSrcEnv creates a Source that reads the process environment.
+func newSrcEnv() *srcEnv {
+	return &srcEnv{lookup: os.LookupEnv}
+}
+
+// envName returns the environment variable name for a config key.
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(key)
+}
+
+// GetProps returns the value of each known key set in the environment.
+func (src *srcEnv) GetProps() (map[string]string, error) {
+	m := make(map[string]string)
+	for _, k := range keysAll {
+		if val, ok := src.lookup(envName(k.name)); ok {
+			m[k.name] = val
+		}
+	}
+	return m, nil
+}
+
+// readSecretFile returns the contents of a file containing a secret, with
+// surrounding whitespace removed. Environment variables in the path are
+// expanded, so "$CREDENTIALS_DIRECTORY/token" works with systemd credentials.
+func readSecretFile(file string) (string, error) {
+	file = os.ExpandEnv(file)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("secret file: %v", err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", file)
+	}
+	return secret, nil
+}
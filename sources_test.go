@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_secretPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("filetoken\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	confFile := filepath.Join(dir, "dynip.conf")
+	conf := "username = u\nhostname = test.example.com\ntoken = conftoken\ninterval = 20 minutes\n"
+	if err := ioutil.WriteFile(confFile, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantToken    string
+		wantInterval string
+	}{
+		{name: "config file", env: nil, wantToken: "conftoken", wantInterval: "20 minutes"},
+		{name: "env overrides file", env: map[string]string{"DYNIP_TOKEN": "envtoken", "DYNIP_INTERVAL": "30 minutes"},
+			wantToken: "envtoken", wantInterval: "30 minutes"},
+		{name: "env token_file overrides file", env: map[string]string{"DYNIP_TOKEN_FILE": tokenFile},
+			wantToken: "filetoken", wantInterval: "20 minutes"},
+		{name: "credentials dir", env: map[string]string{"CREDENTIALS_DIRECTORY": dir, "DYNIP_TOKEN_FILE": "$CREDENTIALS_DIRECTORY/token"},
+			wantToken: "filetoken", wantInterval: "20 minutes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+			}
+			defer func() {
+				for k := range tt.env {
+					os.Unsetenv(k)
+				}
+			}()
+
+			cfg, err := NewAppConfig(confFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.getKeyVal(keyToken); got != tt.wantToken {
+				t.Errorf("token = %v, want %v", got, tt.wantToken)
+			}
+			if got := cfg.getKeyVal(keyInterval); got != tt.wantInterval {
+				t.Errorf("interval = %v, want %v", got, tt.wantInterval)
+			}
+		})
+	}
+}
+
+func Test_secretFileMissing(t *testing.T) {
+	_, err := NewAppConfigFromMap(map[string]string{
+		"username":   "u",
+		"hostname":   "test.example.com",
+		"token_file": "/nonexistent/dynip/token",
+	})
+	if err == nil {
+		t.Error("expected error for missing token_file")
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Syslog message formats for syslog_format.
+const (
+	syslogRFC3164 = "rfc3164"
+	syslogRFC5424 = "rfc5424"
+)
+
+// syslogFacilities maps syslog_facility names to facility codes.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+func syslogFacilityNames() []string {
+	names := make([]string, 0, len(syslogFacilities))
+	for name := range syslogFacilities {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return syslogFacilities[names[i]] < syslogFacilities[names[j]] })
+	return names
+}
+
+// syslogPorts are the default ports for remote syslog.
+var syslogPorts = map[string]string{"udp": "514", "tcp": "514", "tls": "6514"}
+
+// parseSyslogAddress parses a remote syslog address such as
+// "udp://logs.example.com", "tcp://10.0.0.5:601" or "tls://logs.example.com"
+// into a network and host:port.
+func parseSyslogAddress(addr string) (string, string, error) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return "", "", fmt.Errorf("'%s' must be udp://, tcp:// or tls:// plus host and optional port", addr)
+	}
+	port, ok := syslogPorts[strings.ToLower(u.Scheme)]
+	if !ok {
+		return "", "", fmt.Errorf("'%s' must be udp://, tcp:// or tls:// plus host and optional port", addr)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return strings.ToLower(u.Scheme), net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// syslogSDID is the RFC 5424 structured data ID for log fields, under the
+// private enterprise number reserved for documentation.
+const syslogSDID = "dynip@32473"
+
+// syslogQueueSize bounds the entries waiting to be sent; more are dropped
+// until the sender catches up.
+const syslogQueueSize = 1000
+
+var (
+	// syslogRetryDelay is how long entries are dropped after the server
+	// could not be reached, rather than trying again for each one.
+	syslogRetryDelay = time.Second * 30
+	// syslogFlushTimeout bounds how long Close, and a fatal entry, wait
+	// for queued entries to be sent.
+	syslogFlushTimeout = time.Second * 5
+
+	errSyslogDown = errors.New("syslog server unreachable")
+)
+
+// syslogHook is a logrus hook sending entries to the local syslog daemon or
+// a remote syslog server over UDP, TCP or TLS. Entries are queued and sent
+// by a goroutine, so a slow or unreachable server never blocks logging.
+type syslogHook struct {
+	network  string // "local", "udp", "tcp" or "tls"
+	addr     string
+	tls      *tls.Config
+	facility int
+	tag      string
+	format   string
+	hostname string
+	pid      int
+
+	queue   chan string
+	pending sync.WaitGroup // queued entries not yet sent or dropped
+	done    chan struct{}  // closed when the sender exits
+
+	mux     sync.Mutex // guards closed and dropped
+	closed  bool
+	dropped int
+
+	// used only by the sender
+	conn    net.Conn
+	retryAt time.Time
+}
+
+// newSyslogHook returns a syslog hook for the config. The local daemon
+// must be reachable straight away; a remote server is connected to when
+// first needed and again after errors.
+func newSyslogHook(config *AppConfig) (*syslogHook, error) {
+	facility, ok := syslogFacilities[strings.ToLower(config.getKeyVal(keySyslogFacility))]
+	if !ok {
+		facility = syslogFacilities[keySyslogFacility.def]
+	}
+	hook := &syslogHook{
+		network:  "local",
+		facility: facility,
+		tag:      config.getKeyVal(keySyslogTag),
+		format:   strings.ToLower(config.getKeyVal(keySyslogFormat)),
+		pid:      os.Getpid(),
+	}
+	hook.hostname, _ = os.Hostname()
+	if hook.hostname == "" {
+		hook.hostname = "-"
+	}
+
+	addr := config.getKeyVal(keySyslogAddress)
+	if addr == "" {
+		if !hasSysLog() {
+			return nil, fmt.Errorf("local syslog not supported for %s; set %s", runtime.GOOS, keySyslogAddress.name)
+		}
+		conn, err := dialLocalSyslog()
+		if err != nil {
+			return nil, err
+		}
+		hook.conn = conn
+		hook.start()
+		return hook, nil
+	}
+
+	var err error
+	if hook.network, hook.addr, err = parseSyslogAddress(addr); err != nil {
+		return nil, fmt.Errorf("%s: %v", keySyslogAddress.name, err)
+	}
+	if hook.network == "tls" {
+		host, _, _ := net.SplitHostPort(hook.addr)
+		hook.tls = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		if file := config.getKeyVal(keySyslogCAFile); file != "" {
+			hook.tls.RootCAs = x509.NewCertPool()
+			if err := appendCAFile(hook.tls.RootCAs, file); err != nil {
+				return nil, fmt.Errorf("%s: %v", keySyslogCAFile.name, err)
+			}
+		}
+	}
+	hook.start()
+	return hook, nil
+}
+
+// start starts the goroutine sending queued entries.
+func (hook *syslogHook) start() {
+	hook.queue = make(chan string, syslogQueueSize)
+	hook.done = make(chan struct{})
+	go hook.run()
+}
+
+// Levels returns the levels the hook fires for: all of them.
+func (hook *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire queues the entry to be sent, or drops it if the queue is full.
+// Fatal and panic entries wait for the queue to be sent, since the
+// process is about to end.
+func (hook *syslogHook) Fire(entry *logrus.Entry) error {
+	msg := hook.message(entry)
+	hook.mux.Lock()
+	if hook.closed {
+		hook.mux.Unlock()
+		return os.ErrClosed
+	}
+	hook.pending.Add(1)
+	select {
+	case hook.queue <- msg:
+	default:
+		hook.pending.Done()
+		hook.dropped++
+	}
+	hook.mux.Unlock()
+
+	if entry.Level <= logrus.FatalLevel {
+		hook.flush()
+	}
+	return nil
+}
+
+// Close sends the queued entries, waiting at most syslogFlushTimeout,
+// and closes the connection to the syslog server.
+func (hook *syslogHook) Close() error {
+	hook.mux.Lock()
+	if hook.closed {
+		hook.mux.Unlock()
+		return nil
+	}
+	hook.closed = true
+	close(hook.queue)
+	hook.mux.Unlock()
+
+	select {
+	case <-hook.done:
+	case <-time.After(syslogFlushTimeout):
+	}
+	return nil
+}
+
+// flush waits at most syslogFlushTimeout for the queued entries to be sent.
+func (hook *syslogHook) flush() {
+	sent := make(chan struct{})
+	go func() {
+		hook.pending.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(syslogFlushTimeout):
+	}
+}
+
+// run sends queued entries until the queue is closed, then closes the
+// connection. Errors are reported on stderr, as logrus does for hooks.
+func (hook *syslogHook) run() {
+	defer close(hook.done)
+	for msg := range hook.queue {
+		err := hook.send(msg)
+		hook.mux.Lock()
+		if err == errSyslogDown {
+			hook.dropped++
+		}
+		dropped := hook.dropped
+		if err == nil {
+			hook.dropped = 0
+		}
+		hook.mux.Unlock()
+		switch {
+		case err == nil && dropped > 0:
+			fmt.Fprintf(os.Stderr, "syslog: %d message(s) dropped\n", dropped)
+		case err != nil && err != errSyslogDown:
+			fmt.Fprintf(os.Stderr, "syslog: %v; retrying in %v\n", err, syslogRetryDelay)
+		}
+		hook.pending.Done()
+	}
+	if hook.conn != nil {
+		_ = hook.conn.Close()
+	}
+}
+
+// send writes msg, reconnecting once if the connection has failed. After
+// a failure it returns errSyslogDown until syslogRetryDelay has passed.
+func (hook *syslogHook) send(msg string) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if hook.conn == nil {
+			if time.Now().Before(hook.retryAt) {
+				return errSyslogDown
+			}
+			if hook.conn, err = hook.dial(); err != nil {
+				hook.retryAt = time.Now().Add(syslogRetryDelay)
+				return err
+			}
+		}
+		if _, err = hook.conn.Write(hook.frame(msg)); err == nil {
+			return nil
+		}
+		_ = hook.conn.Close()
+		hook.conn = nil
+		if attempt > 0 {
+			hook.retryAt = time.Now().Add(syslogRetryDelay)
+			return err
+		}
+	}
+}
+
+func (hook *syslogHook) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: time.Second * 10}
+	switch hook.network {
+	case "local":
+		return dialLocalSyslog()
+	case "tls":
+		return tls.DialWithDialer(dialer, "tcp", hook.addr, hook.tls)
+	}
+	return dialer.Dial(hook.network, hook.addr)
+}
+
+// syslogSeverity maps logrus levels to syslog severities.
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return 2 // crit
+	case logrus.ErrorLevel:
+		return 3 // err
+	case logrus.WarnLevel:
+		return 4 // warning
+	case logrus.InfoLevel:
+		return 6 // info
+	}
+	return 7 // debug
+}
+
+// message formats an entry as an RFC 3164 or RFC 5424 message. Either way
+// the log_format does not apply: RFC 5424 carries the fields as structured
+// data, and RFC 3164 appends them to the message as key=value pairs.
+func (hook *syslogHook) message(entry *logrus.Entry) string {
+	pri := hook.facility*8 + syslogSeverity(entry.Level)
+	var msg string
+	if hook.format == syslogRFC5424 {
+		msg = fmt.Sprintf("<%d>1 %s %s %s %d - %s %s", pri, entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+			hook.hostname, sdName(hook.tag), hook.pid, structuredData(entry.Data), entry.Message)
+	} else {
+		line := strings.TrimRight(entry.Message, "\n")
+		if fields := logfmtFields(entry.Data); fields != "" {
+			line += " " + fields
+		}
+		if hook.network == "local" {
+			// the local daemon adds the hostname
+			msg = fmt.Sprintf("<%d>%s %s[%d]: %s", pri, entry.Time.Format(time.Stamp), hook.tag, hook.pid, line)
+		} else {
+			msg = fmt.Sprintf("<%d>%s %s %s[%d]: %s", pri, entry.Time.Format(time.Stamp), hook.hostname, hook.tag, hook.pid, line)
+		}
+	}
+	return msg
+}
+
+// frame frames a message for the connection. Datagrams are sent as is;
+// streams use octet counting for RFC 5424 and a trailing newline for
+// RFC 3164.
+func (hook *syslogHook) frame(msg string) []byte {
+	if n := hook.conn.RemoteAddr().Network(); n == "udp" || n == "unixgram" {
+		return []byte(msg)
+	}
+	if hook.format == syslogRFC5424 {
+		return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+	}
+	return []byte(msg + "\n")
+}
+
+// structuredData returns the entry fields as an RFC 5424 SD-ELEMENT, or
+// "-" if there are none.
+func structuredData(fields logrus.Fields) string {
+	if len(fields) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString("[" + syslogSDID)
+	for _, k := range keys {
+		val := fmt.Sprintf("%v", fields[k])
+		if err, ok := fields[k].(error); ok {
+			val = err.Error()
+		}
+		val = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(val)
+		fmt.Fprintf(&sb, ` %s="%s"`, sdName(k), val)
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// sdName makes s a valid RFC 5424 name: printable ASCII without space, '=',
+// ']' or '"', at most 32 characters.
+func sdName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 32 {
+		b = b[:32]
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
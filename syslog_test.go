@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writeServerCert creates a self-signed certificate for 127.0.0.1 and
+// returns it along with the name of its PEM file in dir.
+func writeServerCert(t *testing.T, dir string) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(dir, "server.crt")
+	writeTestFile(t, caFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+func makeSyslogConfig(t *testing.T, vals map[string]string) *AppConfig {
+	m := map[string]string{
+		"hostname": "test.example.com",
+		"username": "testuser",
+		"token":    "testtoken",
+		"syslog":   "YES",
+	}
+	for k, v := range vals {
+		m[k] = v
+	}
+	cfg, err := NewAppConfigFromMap(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func Test_parseSyslogAddress(t *testing.T) {
+	tests := []struct {
+		addr     string
+		network  string
+		hostport string
+		wantErr  bool
+	}{
+		{addr: "udp://logs.example.com", network: "udp", hostport: "logs.example.com:514"},
+		{addr: "TCP://10.0.0.5:601", network: "tcp", hostport: "10.0.0.5:601"},
+		{addr: "tls://logs.example.com", network: "tls", hostport: "logs.example.com:6514"},
+		{addr: "tls://[2001:db8::1]:6514", network: "tls", hostport: "[2001:db8::1]:6514"},
+		{addr: "http://logs.example.com", wantErr: true},
+		{addr: "logs.example.com:514", wantErr: true},
+		{addr: "udp://logs.example.com/path", wantErr: true},
+	}
+	for _, tt := range tests {
+		network, hostport, err := parseSyslogAddress(tt.addr)
+		if (err != nil) != tt.wantErr || network != tt.network || hostport != tt.hostport {
+			t.Errorf("parseSyslogAddress(%q) = %q, %q, %v; want %q, %q, error %v",
+				tt.addr, network, hostport, err, tt.network, tt.hostport, tt.wantErr)
+		}
+	}
+}
+
+func Test_structuredData(t *testing.T) {
+	got := structuredData(logrus.Fields{"result": "NO_AUTH", "err": fmt.Errorf(`bad "token" [x]`), "my key": 1})
+	want := `[dynip@32473 err="bad \"token\" [x\]" my_key="1" result="NO_AUTH"]`
+	if got != want {
+		t.Errorf("structuredData() = %s, want %s", got, want)
+	}
+	if got := structuredData(nil); got != "-" {
+		t.Errorf("structuredData(nil) = %s, want -", got)
+	}
+}
+
+func Test_syslogMessage3164(t *testing.T) {
+	hook := &syslogHook{network: "tcp", format: syslogRFC3164, facility: 3, tag: "dynip", hostname: "myhost", pid: 42}
+	logger := logrus.New()
+	// log_format does not apply to syslog
+	logger.Formatter = logFormatter(logFormatJSON)
+	entry := logger.WithFields(logrus.Fields{"host": "test.example.com", "result": "TOO_SOON"})
+	entry.Level = logrus.WarnLevel
+	entry.Time = time.Date(2024, 3, 1, 8, 30, 0, 0, time.Local)
+	entry.Message = "update failed"
+
+	want := "<28>Mar  1 08:30:00 myhost dynip[42]: update failed host=test.example.com result=TOO_SOON"
+	if got := hook.message(entry); got != want {
+		t.Errorf("message() = %q, want %q", got, want)
+	}
+}
+
+func Test_syslogHookUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	appConfig := makeSyslogConfig(t, map[string]string{
+		"syslog_address":  "udp://" + pc.LocalAddr().String(),
+		"syslog_facility": "local0",
+		"syslog_format":   "rfc5424",
+	})
+	logger, err := configureLogging(appConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeLog(logger)
+	logger.WithFields(logrus.Fields{"host": "test.example.com", "result": "TOO_SOON"}).Warn("update failed")
+
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// local0 (16) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<132>1 ") {
+		t.Errorf("message %q does not start with <132>1", msg)
+	}
+	if want := fmt.Sprintf(` dynip %d - [dynip@32473 host="test.example.com" result="TOO_SOON"] update failed`, os.Getpid()); !strings.HasSuffix(msg, want) {
+		t.Errorf("message %q does not end with %q", msg, want)
+	}
+}
+
+func Test_syslogHookStream(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	cert, caFile := writeServerCert(t, dir)
+
+	tests := []struct {
+		name    string
+		network string
+		format  string
+		read    func(r *bufio.Reader) (string, error)
+	}{
+		{name: "tcp rfc5424", network: "tcp", format: "rfc5424", read: func(r *bufio.Reader) (string, error) {
+			var n int
+			if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+				return "", err
+			}
+			b := make([]byte, n)
+			_, err := io.ReadFull(r, b)
+			return string(b), err
+		}},
+		{name: "tls rfc3164", network: "tls", format: "rfc3164", read: func(r *bufio.Reader) (string, error) {
+			line, err := r.ReadString('\n')
+			return strings.TrimSuffix(line, "\n"), err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l net.Listener
+			var err error
+			if tt.network == "tls" {
+				l, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+			} else {
+				l, err = net.Listen("tcp", "127.0.0.1:0")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			got := make(chan string, 2)
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for i := 0; i < 2; i++ {
+					msg, err := tt.read(r)
+					if err != nil {
+						got <- err.Error()
+						return
+					}
+					got <- msg
+				}
+			}()
+
+			appConfig := makeSyslogConfig(t, map[string]string{
+				"syslog_address": tt.network + "://" + l.Addr().String(),
+				"syslog_format":  tt.format,
+				"syslog_ca_file": caFile,
+				"syslog_tag":     "dynip-test",
+			})
+			logger, err := configureLogging(appConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeLog(logger)
+			logger.Info("first")
+			logger.Error("second")
+
+			for i, want := range []string{"first", "second"} {
+				select {
+				case msg := <-got:
+					// daemon (3) * 8 + info (6) or err (3)
+					pri := []string{"<30>", "<27>"}[i]
+					if !strings.HasPrefix(msg, pri) || !strings.Contains(msg, want) || !strings.Contains(msg, "dynip-test") {
+						t.Errorf("message %d = %q, want %s ... dynip-test ... %s", i, msg, pri, want)
+					}
+				case <-time.After(time.Second * 5):
+					t.Fatalf("message %d not received", i)
+				}
+			}
+		})
+	}
+}
+
+func Test_syslogAndLogFile(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	file := filepath.Join(dir, "dynip.log")
+
+	appConfig := makeSyslogConfig(t, map[string]string{
+		"syslog_address": "udp://" + pc.LocalAddr().String(),
+		"log":            file,
+	})
+	logger, err := configureLogging(appConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("to both")
+	closeLog(logger)
+
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil || !strings.Contains(string(buf[:n]), "to both") {
+		t.Errorf("syslog message = %q, %v", buf[:n], err)
+	}
+	if b, _ := ioutil.ReadFile(file); !strings.Contains(string(b), "to both") {
+		t.Errorf("log file = %q", b)
+	}
+}
+
+func Test_syslogHookBlocked(t *testing.T) {
+	// a server that never reads
+	client, server := net.Pipe()
+	defer server.Close()
+	hook := &syslogHook{network: "tcp", format: syslogRFC3164, tag: "dynip", hostname: "-", conn: client}
+	hook.start()
+
+	saved := syslogFlushTimeout
+	syslogFlushTimeout = time.Millisecond * 100
+	defer func() { syslogFlushTimeout = saved }()
+
+	start := time.Now()
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.InfoLevel
+	for i := 0; i < syslogQueueSize+10; i++ {
+		if err := hook.Fire(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = hook.Close()
+	if d := time.Since(start); d > time.Second*2 {
+		t.Errorf("logging blocked for %v", d)
+	}
+	hook.mux.Lock()
+	dropped := hook.dropped
+	hook.mux.Unlock()
+	if dropped == 0 {
+		t.Error("no entries dropped with a full queue")
+	}
+	if err := hook.Fire(entry); err != os.ErrClosed {
+		t.Errorf("Fire after Close error = %v, want %v", err, os.ErrClosed)
+	}
+}
+
+func Test_syslogHookRetry(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	hook := &syslogHook{network: "tcp", addr: addr, format: syslogRFC3164}
+	if err := hook.send("first"); err == nil || err == errSyslogDown {
+		t.Errorf("send() to a closed port error = %v, want a dial error", err)
+	}
+	if err := hook.send("second"); err != errSyslogDown {
+		t.Errorf("send() before retry error = %v, want %v", err, errSyslogDown)
+	}
+	hook.retryAt = time.Now()
+	if err := hook.send("third"); err == nil || err == errSyslogDown {
+		t.Errorf("send() after retry delay error = %v, want a dial error", err)
+	}
+}
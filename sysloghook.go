@@ -1,15 +1,24 @@
+//go:build !windows && !nacl && !plan9
 // +build !windows,!nacl,!plan9
 
 package main
 
 import (
-	"log/syslog"
-
-	"github.com/sirupsen/logrus"
-	logrussyslog "github.com/sirupsen/logrus/hooks/syslog"
+	"errors"
+	"net"
 )
 
-// syslogHook returns a logrus syslog hook on supported platforms.
-func syslogHook(tag string) (logrus.Hook, error) {
-	return logrussyslog.NewSyslogHook("", "", syslog.LOG_INFO, tag)
+// syslogSockets are the usual paths of the local syslog daemon's socket.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// dialLocalSyslog connects to the local syslog daemon.
+func dialLocalSyslog() (net.Conn, error) {
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range syslogSockets {
+			if conn, err := net.Dial(network, path); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, errors.New("unix syslog delivery error")
 }
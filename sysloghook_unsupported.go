@@ -1,12 +1,15 @@
+//go:build windows || nacl || plan9
 // +build windows nacl plan9
 
 package main
 
 import (
-	"github.com/sirupsen/logrus"
+	"errors"
+	"net"
 )
 
-// syslogHook returns nil on Windows as syslog is not supported.
-func syslogHook(tag string) (logrus.Hook, error) {
-	return nil, nil
+// dialLocalSyslog returns an error as there is no local syslog daemon;
+// a remote syslog server may be used instead.
+func dialLocalSyslog() (net.Conn, error) {
+	return nil, errors.New("local syslog not supported")
 }
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tlsVersions maps tls_min_version values to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsVersionNames returns the supported tls_min_version values in order.
+func tlsVersionNames() []string {
+	var names []string
+	for name := range tlsVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pinPrefix may precede a base64 SPKI pin.
+const pinPrefix = "sha256/"
+
+// newUpdateClient creates an HTTP client for update requests, using the
+// host's TLS settings. Detection requests use newHTTPClient directly, since
+// a private CA for the provider would not verify public detection services.
+func newUpdateClient(appConfig *AppConfig, timeout time.Duration) (*http.Client, error) {
+	client, err := newHTTPClient(appConfig, timeout)
+	if err != nil {
+		return nil, err
+	}
+	tc, err := tlsConfig(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	if tc != nil {
+		client.Transport.(*http.Transport).TLSClientConfig = tc
+	}
+	return client, nil
+}
+
+// tlsConfig returns the TLS config for the host's update requests, or nil
+// if no TLS settings are configured.
+func tlsConfig(appConfig *AppConfig) (*tls.Config, error) {
+	caFile := appConfig.getKeyVal(keyTLSCAFile)
+	caDir := appConfig.getKeyVal(keyTLSCADir)
+	minVersion := appConfig.getKeyVal(keyTLSMinVersion)
+	pin := appConfig.getKeyVal(keyTLSPin)
+	certFile := appConfig.getKeyVal(keyTLSCertFile)
+	keyFile := appConfig.getKeyVal(keyTLSKeyFile)
+	insecure := isTrue(appConfig.getKeyVal(keyTLSInsecure))
+
+	if caFile == "" && caDir == "" && minVersion == "" && pin == "" && certFile == "" && keyFile == "" && !insecure {
+		return nil, nil
+	}
+	tc := &tls.Config{InsecureSkipVerify: insecure}
+
+	if minVersion != "" {
+		v, ok := tlsVersions[minVersion]
+		if !ok {
+			return nil, fmt.Errorf("%s: '%s' must be one of %s", keyTLSMinVersion.name, minVersion, strings.Join(tlsVersionNames(), ", "))
+		}
+		tc.MinVersion = v
+	}
+
+	if caFile != "" || caDir != "" {
+		// only the given CAs are trusted, not the system roots
+		tc.RootCAs = x509.NewCertPool()
+		if caFile != "" {
+			if err := appendCAFile(tc.RootCAs, caFile); err != nil {
+				return nil, fmt.Errorf("%s: %v", keyTLSCAFile.name, err)
+			}
+		}
+		if caDir != "" {
+			if err := appendCADir(tc.RootCAs, caDir); err != nil {
+				return nil, fmt.Errorf("%s: %v", keyTLSCADir.name, err)
+			}
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("%s and %s must be set together", keyTLSCertFile.name, keyTLSKeyFile.name)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", keyTLSCertFile.name, err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	if pin != "" {
+		pins, err := parsePins(pin)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", keyTLSPin.name, err)
+		}
+		tc.VerifyPeerCertificate = verifyPins(pins)
+	}
+	return tc, nil
+}
+
+// appendCAFile adds the PEM certificates in file to pool.
+func appendCAFile(pool *x509.CertPool, file string) error {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no PEM certificates found in %s", file)
+	}
+	return nil
+}
+
+// appendCADir adds the PEM certificates in the files in dir to pool.
+func appendCADir(pool *x509.CertPool, dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var found bool
+	for _, fi := range files {
+		name := filepath.Join(dir, fi.Name())
+		// follow symlinks, such as the hash links made by c_rehash
+		if fi, err = os.Stat(name); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		pem, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if pool.AppendCertsFromPEM(pem) {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no PEM certificates found in %s", dir)
+	}
+	return nil
+}
+
+// parsePins parses comma separated base64 SHA-256 hashes of certificates'
+// SubjectPublicKeyInfo, each optionally prefixed with "sha256/".
+func parsePins(val string) ([][]byte, error) {
+	var pins [][]byte
+	for _, s := range strings.Split(val, ",") {
+		s = strings.TrimPrefix(strings.TrimSpace(s), pinPrefix)
+		if s == "" {
+			continue
+		}
+		pin, err := base64.StdEncoding.DecodeString(s)
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("'%s' is not a base64 SHA-256 hash", s)
+		}
+		pins = append(pins, pin)
+	}
+	if len(pins) == 0 {
+		return nil, fmt.Errorf("no pins")
+	}
+	return pins, nil
+}
+
+// spkiPin returns the SHA-256 hash of the certificate's public key.
+func spkiPin(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+// verifyPins returns a function for tls.Config.VerifyPeerCertificate that
+// requires a certificate in the verified chain to match one of the pins.
+// With verification disabled only the server's own certificate is
+// checked, since the rest of the presented chain is not trustworthy.
+func verifyPins(pins [][]byte) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var certs []*x509.Certificate
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(verifiedChains) == 0 && len(rawCerts) > 0 {
+			leaf, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			certs = append(certs, leaf)
+		}
+		for _, cert := range certs {
+			hash := spkiPin(cert)
+			for _, pin := range pins {
+				if bytes.Equal(hash, pin) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("server certificate does not match %s", keyTLSPin.name)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	stdlog "log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wiggin77/dynip/pkg/dynip"
+)
+
+// writeClientCert creates a self-signed client certificate and key in dir
+// and returns the certificate and the two file names.
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dynip"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	writeTestFile(t, certFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	writeTestFile(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})))
+	return cert, certFile, keyFile
+}
+
+func Test_tlsConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, respSUCCESS)
+	}))
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	ts.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven, MaxVersion: tls.VersionTLS12}
+	ts.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	serverCert := ts.Certificate()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeTestFile(t, caFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert.Raw})))
+	caDir := filepath.Join(dir, "certs")
+	if err := os.Mkdir(caDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(caDir, "ca.pem"), string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert.Raw})))
+	pin := pinPrefix + base64.StdEncoding.EncodeToString(spkiPin(serverCert))
+	otherPin := base64.StdEncoding.EncodeToString(spkiPin(clientCert))
+
+	tlog := logrus.New()
+	tlog.Out = ioutil.Discard
+	log := tlog.WithField("test", "tls")
+
+	tests := []struct {
+		name    string
+		vals    map[string]string
+		wantErr string
+	}{
+		{name: "system roots", wantErr: "certificate"},
+		{name: "ca file", vals: map[string]string{"tls_ca_file": caFile}},
+		{name: "ca dir", vals: map[string]string{"tls_ca_dir": caDir}},
+		{name: "pin", vals: map[string]string{"tls_ca_file": caFile, "tls_pin": otherPin + ", " + pin}},
+		{name: "wrong pin", vals: map[string]string{"tls_ca_file": caFile, "tls_pin": otherPin}, wantErr: "does not match"},
+		{name: "insecure", vals: map[string]string{"tls_insecure_skip_verify": "yes"}},
+		{name: "insecure wrong pin", vals: map[string]string{"tls_insecure_skip_verify": "yes", "tls_pin": otherPin}, wantErr: "does not match"},
+		{name: "min version", vals: map[string]string{"tls_ca_file": caFile, "tls_min_version": "1.3"}, wantErr: "version"},
+		{name: "client cert", vals: map[string]string{"tls_ca_file": caFile, "tls_cert_file": certFile, "tls_key_file": keyFile}},
+		{name: "cert without key", vals: map[string]string{"tls_cert_file": certFile}, wantErr: "must be set together"},
+	}
+	for _, tt := range tests {
+		vals := map[string]string{"hostname": "office.example.com", "username": "u", "token": "t",
+			"url": strings.TrimPrefix(ts.URL, "https://") + "/dyn/", "proto": "https"}
+		for k, v := range tt.vals {
+			vals[k] = v
+		}
+		cfg, err := NewAppConfigFromMap(vals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply, err := sendRequest(context.Background(), cfg, log, "203.0.113.1", "t")
+		if tt.wantErr == "" {
+			if err != nil || reply.Result != dynip.SUCCESS {
+				t.Errorf("%s: %v, %v", tt.name, reply.Result, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// a server requiring a client certificate
+	mtls := httptest.NewUnstartedServer(ts.Config.Handler)
+	mtls.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.RequireAndVerifyClientCert}
+	mtls.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0)
+	mtls.StartTLS()
+	defer mtls.Close()
+	caFile = filepath.Join(dir, "mtls.pem")
+	writeTestFile(t, caFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mtls.Certificate().Raw})))
+	for _, withCert := range []bool{true, false} {
+		vals := map[string]string{"hostname": "office.example.com", "username": "u", "token": "t",
+			"url": strings.TrimPrefix(mtls.URL, "https://") + "/dyn/", "proto": "https", "tls_ca_file": caFile}
+		if withCert {
+			vals["tls_cert_file"] = certFile
+			vals["tls_key_file"] = keyFile
+		}
+		cfg, err := NewAppConfigFromMap(vals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sendRequest(context.Background(), cfg, log, "203.0.113.1", "t"); (err == nil) != withCert {
+			t.Errorf("mutual TLS with client certificate %v: %v", withCert, err)
+		}
+	}
+}
+
+func Test_parsePins(t *testing.T) {
+	good := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	if pins, err := parsePins("sha256/" + good + ", " + good); err != nil || len(pins) != 2 {
+		t.Errorf("parsePins() = %d pins, %v", len(pins), err)
+	}
+	for _, val := range []string{"", ",", "not base64!", base64.StdEncoding.EncodeToString(make([]byte, 20))} {
+		if _, err := parsePins(val); err == nil {
+			t.Errorf("parsePins(%q) should fail", val)
+		}
+	}
+}